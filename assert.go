@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+)
+
+// AssertResult is result of single assertion check
+type AssertResult struct {
+	Name string
+	// Failure is reason of failure, empty when passed
+	Failure string
+}
+
+// Evaluate checks report against each configured assertion
+func (a Assert) Evaluate(r ScenarioReport) []AssertResult {
+	var results []AssertResult
+	check := func(name string, failed bool, format string, args ...interface{}) {
+		result := AssertResult{Name: name}
+		if failed {
+			result.Failure = fmt.Sprintf(format, args...)
+		}
+		results = append(results, result)
+	}
+
+	total := r.SuccessCount + r.ValidationFailCount + r.RequestFailCount
+	errCount := r.ValidationFailCount + r.RequestFailCount
+	if a.SuccessRate != nil {
+		var rate float64
+		if total > 0 {
+			rate = float64(r.SuccessCount) / float64(total)
+		}
+		check("success rate", rate < *a.SuccessRate, "expected >= %.4f, got: %.4f", *a.SuccessRate, rate)
+	}
+	if a.P95 != nil {
+		check("p95", r.Latency.P95 > *a.P95, "expected <= %v, got: %v", *a.P95, r.Latency.P95)
+	}
+	if a.MaxCV != nil {
+		cv := r.Latency.CV()
+		check("latency cv", cv > *a.MaxCV, "expected <= %.3f, got: %.3f", *a.MaxCV, cv)
+	}
+	if a.MaxErrors != nil {
+		check("errors", errCount > *a.MaxErrors, "expected <= %d, got: %d", *a.MaxErrors, errCount)
+	}
+	if a.MaxWindowErrorRate != nil {
+		check("window error rate", r.WorstWindowErrorRate > *a.MaxWindowErrorRate, "expected <= %.4f in any %v, got: %.4f at %v",
+			*a.MaxWindowErrorRate, r.ErrorRateWindow, r.WorstWindowErrorRate, r.WorstWindowAt)
+	}
+	if a.MinAchievedRPS != nil {
+		check("achieved rps", r.AchievedRPS < *a.MinAchievedRPS, "expected >= %.2f, got: %.2f (requested: %s)",
+			*a.MinAchievedRPS, r.AchievedRPS, Throughput(r.RequestedRPS))
+	}
+	return results
+}
+
+// assertFailures returns failure reasons of results
+func assertFailures(results []AssertResult) []string {
+	var failures []string
+	for _, r := range results {
+		if r.Failure != "" {
+			failures = append(failures, r.Name+": "+r.Failure)
+		}
+	}
+	return failures
+}
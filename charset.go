@@ -0,0 +1,79 @@
+package main
+
+import (
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// defaultCharset is charset of response without charset parameter
+const defaultCharset = "utf-8"
+
+// charsetVerifiers check body is valid in charset, keyed by lower case
+// charset name
+var charsetVerifiers = map[string]func([]byte) bool{
+	"utf-8":      utf8.Valid,
+	"utf8":       utf8.Valid,
+	"us-ascii":   isASCII,
+	"ascii":      isASCII,
+	"iso-8859-1": func([]byte) bool { return true },
+	"latin1":     func([]byte) bool { return true },
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCharset reports whether validate checks charset
+func (v Validate) hasCharset() bool {
+	return v.Charset != nil || v.VerifyCharset
+}
+
+// expectedCharset returns charset response must declare
+func (v Validate) expectedCharset() string {
+	if v.Charset != nil {
+		return strings.ToLower(*v.Charset)
+	}
+	return defaultCharset
+}
+
+// validateCharset checks charset can be verified, before run
+func (v Validate) validateCharset() error {
+	if !v.VerifyCharset {
+		return nil
+	}
+	if _, ok := charsetVerifiers[v.expectedCharset()]; !ok {
+		return xerrors.Errorf("verify_charset does not support charset: %s", v.expectedCharset())
+	}
+	return nil
+}
+
+// checkCharset validates charset parameter of Content-Type, and with
+// verify_charset that body is valid in it
+func (v Validate) checkCharset(res *response) error {
+	declared := defaultCharset
+	if ct := res.Header.Get("Content-Type"); ct != "" {
+		_, params, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return xerrors.Errorf("charset: parse content type %q: %w", ct, err)
+		}
+		if c, ok := params["charset"]; ok {
+			declared = strings.ToLower(c)
+		}
+	}
+	expected := v.expectedCharset()
+	if declared != expected {
+		return xerrors.Errorf("charset is invalid: expected: %v, got: %v", expected, declared)
+	}
+	if v.VerifyCharset && !charsetVerifiers[expected](res.body) {
+		return xerrors.Errorf("body is not valid %s", expected)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// live is registry of running scenario reports
+var live = &liveReports{builders: make(map[string]*reportBuilder)}
+
+// liveReports holds report builders of running scenarios, so that
+// in-progress results can be read during run
+type liveReports struct {
+	mu       sync.Mutex
+	builders map[string]*reportBuilder
+}
+
+func (l *liveReports) register(b *reportBuilder) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.builders[b.s.Name] = b
+}
+
+// snapshot returns copy of registered builders
+func (l *liveReports) snapshot() map[string]*reportBuilder {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := make(map[string]*reportBuilder, len(l.builders))
+	for name, b := range l.builders {
+		m[name] = b
+	}
+	return m
+}
+
+// counts returns current counts of all registered scenarios
+func (l *liveReports) counts() map[string]CheckpointCounts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m := make(map[string]CheckpointCounts, len(l.builders))
+	for name, b := range l.builders {
+		m[name] = b.counts()
+	}
+	return m
+}
+
+// Checkpoint is in-progress results persisted during run
+type Checkpoint struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	// Finished is true when run ended normally
+	Finished  bool                        `json:"finished"`
+	Scenarios map[string]CheckpointCounts `json:"scenarios"`
+}
+
+// CheckpointCounts is result counts of scenario
+type CheckpointCounts struct {
+	Success        int `json:"success"`
+	ValidationFail int `json:"validation_fail"`
+	RequestFail    int `json:"request_fail"`
+}
+
+// total returns count of completed requests
+func (c CheckpointCounts) total() int {
+	return c.Success + c.ValidationFail + c.RequestFail
+}
+
+// resumed is counts of previous run read by -resume. They are added to
+// reports, so that checkpoint and result keep counting toward the target
+var resumed map[string]CheckpointCounts
+
+// readCheckpoint reads checkpoint written by writeCheckpoint
+func readCheckpoint(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("checkpoint: %w", err)
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, xerrors.Errorf("checkpoint: %w", err)
+	}
+	return c, nil
+}
+
+// resumeScenario returns scenario running only requests which were not
+// completed in previous run
+func resumeScenario(s Scenario, done CheckpointCounts) Scenario {
+	remaining := requestCount(s) - done.total()
+	if remaining < 0 {
+		remaining = 0
+	}
+	s.Count = &remaining
+	return s
+}
+
+// reachedTargets reports whether run completed request count of every
+// scenario, or its whole period when count is unbounded. With mixed, the
+// sum of counts is the target, as scenarios are picked by weight
+func reachedTargets(scenarios []Scenario, reports map[string]ScenarioReport, mixed bool) bool {
+	var completed, target int
+	for _, s := range scenarios {
+		r, ok := reports[s.Name]
+		if !ok || r.AbortReason != "" {
+			return false
+		}
+		n := requestCount(s)
+		if n == unboundedCount {
+			if r.Elapsed < time.Duration(*s.Period)*time.Second {
+				return false
+			}
+			continue
+		}
+		done := r.SuccessCount + r.ValidationFailCount + r.RequestFailCount
+		n += resumed[s.Name].total()
+		if !mixed && done < n {
+			return false
+		}
+		completed += done
+		target += n
+	}
+	return completed >= target
+}
+
+// runCheckpoint writes checkpoint every interval until ctx is done
+func runCheckpoint(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := writeCheckpoint(path, false); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+	}
+}
+
+// writeCheckpoint writes live counts atomically (temp file + rename)
+func writeCheckpoint(path string, finished bool) error {
+	b, err := json.MarshalIndent(Checkpoint{
+		UpdatedAt: time.Now(),
+		Finished:  finished,
+		Scenarios: live.counts(),
+	}, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("checkpoint: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return xerrors.Errorf("checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		_ = tmp.Close()
+		return xerrors.Errorf("checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("checkpoint: %w", err)
+	}
+	return nil
+}
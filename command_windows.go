@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, Windows has no process group to kill
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process of cmd only, its children keep
+// running
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// needsCompression reports whether scenario requests gzip by itself to
+// see compressed size. Transport decodes gzip transparently otherwise
+func (s Scenario) needsCompression() bool {
+	for _, v := range s.Validates {
+		if v.hasCompressionRatio() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCompressionRatio reports whether validate checks compression ratio
+func (v Validate) hasCompressionRatio() bool {
+	return v.CompressionRatioMin != nil || v.CompressionRatioMax != nil
+}
+
+// readCompressedBody reads body of response to Accept-Encoding: gzip
+// request. Body is decoded, and wire and decoded sizes are kept when
+// response is gzip encoded
+func readCompressedBody(res *response) error {
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		res.body = raw
+		return nil
+	}
+	res.compressed = true
+	res.wireBytes = len(raw)
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err == nil {
+		res.body, err = ioutil.ReadAll(zr)
+	}
+	if err != nil {
+		res.decodeErr = xerrors.Errorf("decode gzip body: %w", err)
+		return nil
+	}
+	res.decodedBytes = len(res.body)
+	// body is decoded, as transport does for its own gzip requests
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	return nil
+}
+
+// checkCompressionRatio validates compressed / decoded size of body.
+// Response which is not compressed is skipped
+func (v Validate) checkCompressionRatio(res *response) error {
+	if res.decodeErr != nil {
+		return res.decodeErr
+	}
+	if !res.compressed || res.decodedBytes == 0 {
+		return nil
+	}
+	ratio := float64(res.wireBytes) / float64(res.decodedBytes)
+	if v.CompressionRatioMax != nil && ratio > *v.CompressionRatioMax {
+		return xerrors.Errorf("compression ratio is invalid: expected <= %.3f, got: %.3f (%d / %d bytes)",
+			*v.CompressionRatioMax, ratio, res.wireBytes, res.decodedBytes)
+	}
+	if v.CompressionRatioMin != nil && ratio < *v.CompressionRatioMin {
+		return xerrors.Errorf("compression ratio is invalid: expected >= %.3f, got: %.3f (%d / %d bytes)",
+			*v.CompressionRatioMin, ratio, res.wireBytes, res.decodedBytes)
+	}
+	return nil
+}
+
+// setAcceptGzip requests gzip explicitly, which disables transparent
+// decoding of transport
+func setAcceptGzip(req *http.Request) {
+	req.Header.Set("Accept-Encoding", "gzip")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/xerrors"
+)
+
+// CookieValidate is expected Set-Cookie of response
+type CookieValidate struct {
+	Name string `yaml:"name,omitempty"`
+	// Value is compared when set
+	Value    *string `yaml:"value,omitempty"`
+	HTTPOnly *bool   `yaml:"http_only,omitempty"`
+	Secure   *bool   `yaml:"secure,omitempty"`
+	// SameSite is one of lax, strict or default (not set or other value)
+	SameSite *string `yaml:"same_site,omitempty"`
+}
+
+// sameSiteNames maps http.SameSite to same_site value
+var sameSiteNames = map[http.SameSite]string{
+	http.SameSiteDefaultMode: "default",
+	http.SameSiteLaxMode:     "lax",
+	http.SameSiteStrictMode:  "strict",
+}
+
+// check validates cookie set by response
+func (c CookieValidate) check(res *response) error {
+	var cookie *http.Cookie
+	for _, ck := range res.Cookies() {
+		if ck.Name == c.Name {
+			cookie = ck
+		}
+	}
+	if cookie == nil {
+		return xerrors.Errorf("cookie is missing: %s", c.Name)
+	}
+	if c.Value != nil && cookie.Value != *c.Value {
+		return xerrors.Errorf("cookie %s value is invalid: expected: %v, got: %v", c.Name, *c.Value, cookie.Value)
+	}
+	if c.HTTPOnly != nil && cookie.HttpOnly != *c.HTTPOnly {
+		return xerrors.Errorf("cookie %s attribute is invalid: expected HttpOnly: %v, got: %v", c.Name, *c.HTTPOnly, cookie.HttpOnly)
+	}
+	if c.Secure != nil && cookie.Secure != *c.Secure {
+		return xerrors.Errorf("cookie %s attribute is invalid: expected Secure: %v, got: %v", c.Name, *c.Secure, cookie.Secure)
+	}
+	if c.SameSite != nil {
+		got := sameSiteNames[cookie.SameSite]
+		if got == "" {
+			got = "default"
+		}
+		if got != *c.SameSite {
+			return xerrors.Errorf("cookie %s attribute is invalid: expected SameSite: %v, got: %v", c.Name, *c.SameSite, got)
+		}
+	}
+	return nil
+}
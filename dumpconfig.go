@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// redacted replaces values which look like secrets in -dump-config and
+// manifest
+const redacted = "REDACTED"
+
+// secretKeys are substrings of query parameter names treated as secrets
+var secretKeys = []string{"token", "secret", "password", "passwd", "key", "auth", "signature", "credential"}
+
+// effectiveConfig is every setting run uses, printed by -dump-config
+type effectiveConfig struct {
+	Version   string            `yaml:"version"`
+	Flags     map[string]string `yaml:"flags"`
+	Transport transportConfig   `yaml:"transport"`
+	// Transports is named transports referenced by scenarios
+	Transports map[string]TransportConfig `yaml:"transports,omitempty"`
+	Scenarios  []Scenario                 `yaml:"scenarios"`
+}
+
+// transportConfig is settings of http.DefaultTransport and client
+type transportConfig struct {
+	Timeout                string `yaml:"timeout"`
+	MaxIdleConns           int    `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost    int    `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost        int    `yaml:"max_conns_per_host"`
+	MaxResponseHeaderBytes int64  `yaml:"max_response_header_bytes"`
+	Workers                int    `yaml:"workers_per_scenario"`
+}
+
+// dumpConfig writes effective settings of run as yaml, with secrets in
+// URLs redacted. scenarios are after -shard and -resume are applied
+func dumpConfig(w io.Writer, scenarios []Scenario) error {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = redactURL(f.Value.String())
+	})
+	t := http.DefaultTransport.(*http.Transport)
+	c := effectiveConfig{
+		Version: version,
+		Flags:   flags,
+		Transport: transportConfig{
+			Timeout:                (time.Duration(httpTimeout) * time.Second).String(),
+			MaxIdleConns:           t.MaxIdleConns,
+			MaxIdleConnsPerHost:    t.MaxIdleConnsPerHost,
+			MaxConnsPerHost:        t.MaxConnsPerHost,
+			MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
+			Workers:                httpWorkerNum,
+		},
+	}
+	for _, s := range scenarios {
+		if s.transport != nil {
+			if c.Transports == nil {
+				c.Transports = make(map[string]TransportConfig)
+			}
+			c.Transports[s.transport.name] = s.transport.config
+		}
+		c.Scenarios = append(c.Scenarios, redactScenario(s))
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// redactScenario returns copy of scenario with secrets in URLs redacted
+func redactScenario(s Scenario) Scenario {
+	s.URL = redactURL(s.URL)
+	if len(s.URLs) > 0 {
+		urls := make([]WeightedURL, len(s.URLs))
+		for i, u := range s.URLs {
+			u.URL = redactURL(u.URL)
+			urls[i] = u
+		}
+		s.URLs = urls
+	}
+	if len(s.Headers) > 0 {
+		headers := make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			if isSecretKey(k) {
+				v = redacted
+			}
+			headers[k] = v
+		}
+		s.Headers = headers
+	}
+	if s.HealthCheck != nil {
+		h := *s.HealthCheck
+		h.URL = redactURL(h.URL)
+		s.HealthCheck = &h
+	}
+	return s
+}
+
+// redactURL redacts password of userinfo and query parameters which look
+// like secrets. Values which are not absolute URLs are returned as is
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return v
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	q := u.Query()
+	changed := false
+	for k := range q {
+		if isSecretKey(k) {
+			q.Set(k, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	// p is password parameter of InfluxDB
+	if k == "p" {
+		return true
+	}
+	for _, s := range secretKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
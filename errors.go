@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// request error kinds of ErrorBreakdown
+const (
+	errKindTimeout           = "timeout"
+	errKindCanceled          = "canceled"
+	errKindConnectionRefused = "connection_refused"
+	errKindConnectionReset   = "connection_reset"
+	errKindDNS               = "dns"
+	errKindHeaderTooLarge    = "header_too_large"
+	errKindTooManyRedirects  = "too_many_redirects"
+	errKindBodyRead          = "body_read"
+	errKindOther             = "other"
+)
+
+// bodyReadError is error reading response body after response header was
+// received, i.e. server started responding and then failed
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return "read body: " + e.err.Error()
+}
+
+func (e *bodyReadError) Unwrap() error {
+	return e.err
+}
+
+// errorChain returns err and errors wrapped by it, outermost first.
+// Errors of net/url, net and os have no Unwrap before Go 1.13, so they
+// are unwrapped explicitly
+func errorChain(err error) []error {
+	var chain []error
+	for err != nil {
+		chain = append(chain, err)
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			err = xerrors.Unwrap(err)
+		}
+	}
+	return chain
+}
+
+// inChain reports whether any error of chain matches
+func inChain(chain []error, match func(error) bool) bool {
+	for _, e := range chain {
+		if match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// is returns matcher of target error
+func is(target error) func(error) bool {
+	return func(err error) bool {
+		return err == target
+	}
+}
+
+// classifyError returns kind of transport error
+func classifyError(err error) string {
+	chain := errorChain(err)
+	switch {
+	case inChain(chain, func(e error) bool { _, ok := e.(*bodyReadError); return ok }):
+		return errKindBodyRead
+	case isHeaderTooLarge(err):
+		return errKindHeaderTooLarge
+	case inChain(chain, is(errTooManyRedirects)):
+		return errKindTooManyRedirects
+	case inChain(chain, is(context.DeadlineExceeded)):
+		return errKindTimeout
+	case inChain(chain, is(context.Canceled)):
+		return errKindCanceled
+	case inChain(chain, is(syscall.ECONNREFUSED)):
+		return errKindConnectionRefused
+	case inChain(chain, is(syscall.ECONNRESET)):
+		return errKindConnectionReset
+	case inChain(chain, func(e error) bool { _, ok := e.(*net.DNSError); return ok }):
+		return errKindDNS
+	case inChain(chain, func(e error) bool { netErr, ok := e.(net.Error); return ok && netErr.Timeout() }):
+		return errKindTimeout
+	default:
+		return errKindOther
+	}
+}
+
+// isConnectError reports whether err is failure to establish connection,
+// such as DNS failure or connection refused, not an error response
+func isConnectError(err error) bool {
+	return inChain(errorChain(err), func(e error) bool {
+		opErr, ok := e.(*net.OpError)
+		return ok && opErr.Op == "dial"
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+)
+
+// defaultErrorRateWindow is window of worst error rate when assert does
+// not set error_rate_window
+const defaultErrorRateWindow = 5 * time.Second
+
+// errorWindow counts requests and errors per second of scenario run, to
+// find the worst error rate of any window of consecutive seconds
+type errorWindow struct {
+	started time.Time
+	buckets []errorBucket
+}
+
+type errorBucket struct {
+	total, errors int
+}
+
+func newErrorWindow(started time.Time) *errorWindow {
+	return &errorWindow{started: started}
+}
+
+// add counts result finished at t
+func (w *errorWindow) add(t time.Time, failed bool) {
+	i := int(t.Sub(w.started) / time.Second)
+	if i < 0 {
+		i = 0
+	}
+	for len(w.buckets) <= i {
+		w.buckets = append(w.buckets, errorBucket{})
+	}
+	w.buckets[i].total++
+	if failed {
+		w.buckets[i].errors++
+	}
+}
+
+// worst returns highest error rate of window and its start offset. Run
+// shorter than window is one window. Seconds without requests are in
+// windows but do not change rate
+func (w *errorWindow) worst(window time.Duration) (float64, time.Duration) {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	if n > len(w.buckets) {
+		n = len(w.buckets)
+	}
+	var worst float64
+	var at time.Duration
+	var sum errorBucket
+	for i, b := range w.buckets {
+		sum.total += b.total
+		sum.errors += b.errors
+		if i >= n {
+			sum.total -= w.buckets[i-n].total
+			sum.errors -= w.buckets[i-n].errors
+		}
+		if i < n-1 || sum.total == 0 {
+			continue
+		}
+		if rate := float64(sum.errors) / float64(sum.total); rate > worst {
+			worst = rate
+			at = time.Duration(i-n+1) * time.Second
+		}
+	}
+	return worst, at
+}
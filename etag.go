@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+)
+
+// cacheValidator is ETag and Last-Modified of a response, sent back as
+// If-None-Match and If-Modified-Since to revalidate it
+type cacheValidator struct {
+	etag         string
+	lastModified string
+}
+
+// ok reports whether response had any validator
+func (v cacheValidator) ok() bool {
+	return v.etag != "" || v.lastModified != ""
+}
+
+// set sets conditional headers of validator to req
+func (v cacheValidator) set(req *http.Request) {
+	if v.etag != "" {
+		req.Header.Set("If-None-Match", v.etag)
+	}
+	if v.lastModified != "" {
+		req.Header.Set("If-Modified-Since", v.lastModified)
+	}
+}
+
+// etagCache is validators per scenario and URL held by one worker, as a
+// client cache would. It is used only by its worker goroutine
+type etagCache map[string]cacheValidator
+
+func etagCacheKey(s Scenario) string {
+	return s.Name + "\x00" + s.URL
+}
+
+// validator returns stored validator of scenario URL
+func (c etagCache) validator(s Scenario) cacheValidator {
+	if !s.EtagRevalidate || c == nil {
+		return cacheValidator{}
+	}
+	return c[etagCacheKey(s)]
+}
+
+// store keeps validators of response. 304 may omit them, stored ones are
+// kept then
+func (c etagCache) store(s Scenario, resp *http.Response) {
+	v := cacheValidator{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	if !v.ok() {
+		if resp.StatusCode != http.StatusNotModified {
+			delete(c, etagCacheKey(s))
+		}
+		return
+	}
+	c[etagCacheKey(s)] = v
+}
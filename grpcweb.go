@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// gRPC-web frame flags
+const (
+	grpcWebDataFrame    byte = 0x00
+	grpcWebTrailerFrame byte = 0x80
+)
+
+// newGRPCWebRequest creates request sending scenario message as single
+// gRPC-web data frame
+func newGRPCWebRequest(s Scenario) (*http.Request, error) {
+	frame, err := grpcWebFrame(s)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Accept", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	return req, nil
+}
+
+// grpcWebFrame encodes grpc_message of scenario as gRPC-web data frame
+func grpcWebFrame(s Scenario) ([]byte, error) {
+	msg, err := base64.StdEncoding.DecodeString(s.GRPCMessage)
+	if err != nil {
+		return nil, xerrors.Errorf("decode grpc_message: %w", err)
+	}
+
+	frame := make([]byte, 5+len(msg))
+	frame[0] = grpcWebDataFrame
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame, nil
+}
+
+// readGRPCWebStatus reads grpc-status from response headers (trailers-only
+// response) or from trailer frame in body
+func readGRPCWebStatus(resp *http.Response) (int, error) {
+	if v := resp.Header.Get("Grpc-Status"); v != "" {
+		return strconv.Atoi(v)
+	}
+
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(resp.Body, header[:]); err != nil {
+			if err == io.EOF {
+				return 0, xerrors.New("grpc-status not found")
+			}
+			return 0, err
+		}
+		length := binary.BigEndian.Uint32(header[1:5])
+		if header[0]&grpcWebTrailerFrame == 0 {
+			if _, err := io.CopyN(ioutil.Discard, resp.Body, int64(length)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		trailer := make([]byte, length)
+		if _, err := io.ReadFull(resp.Body, trailer); err != nil {
+			return 0, err
+		}
+		// trailer frame is HTTP/1 style header block without final blank line
+		r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(trailer), strings.NewReader("\r\n"))))
+		mime, err := r.ReadMIMEHeader()
+		if err != nil {
+			return 0, xerrors.Errorf("parse trailer: %w", err)
+		}
+		v := mime.Get("Grpc-Status")
+		if v == "" {
+			return 0, xerrors.New("grpc-status not found")
+		}
+		return strconv.Atoi(v)
+	}
+}
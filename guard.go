@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultLatencyWindow is rolling window of latency_abort when not set
+const defaultLatencyWindow = 10 * time.Second
+
+// LatencyAbort aborts scenario when rolling p95 stays above P95 for Duration
+type LatencyAbort struct {
+	P95      time.Duration `yaml:"p95,omitempty"`
+	Duration time.Duration `yaml:"duration,omitempty"`
+	// Window is span of recent responses rolling p95 is calculated from
+	Window time.Duration `yaml:"window,omitempty"`
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// latencyGuard tracks rolling p95 of scenario for latency_abort
+type latencyGuard struct {
+	cfg           LatencyAbort
+	samples       []latencySample
+	exceededSince time.Time
+}
+
+func newLatencyGuard(cfg LatencyAbort) *latencyGuard {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultLatencyWindow
+	}
+	return &latencyGuard{cfg: cfg}
+}
+
+func (g *latencyGuard) add(now time.Time, latency time.Duration) {
+	g.samples = append(g.samples, latencySample{at: now, latency: latency})
+}
+
+// check returns abort reason when rolling p95 exceeded ceiling for duration
+func (g *latencyGuard) check(now time.Time) (string, bool) {
+	// drop samples out of window
+	i := 0
+	for i < len(g.samples) && now.Sub(g.samples[i].at) > g.cfg.Window {
+		i++
+	}
+	g.samples = g.samples[i:]
+	if len(g.samples) == 0 {
+		return "", false
+	}
+
+	latencies := make([]time.Duration, len(g.samples))
+	for i, sample := range g.samples {
+		latencies[i] = sample.latency
+	}
+	p95 := NewLatencyStats(latencies).P95
+	if p95 <= g.cfg.P95 {
+		g.exceededSince = time.Time{}
+		return "", false
+	}
+	if g.exceededSince.IsZero() {
+		g.exceededSince = now
+	}
+	if now.Sub(g.exceededSince) < g.cfg.Duration {
+		return "", false
+	}
+	return fmt.Sprintf("rolling p95 %v exceeded %v for %v", p95, g.cfg.P95, g.cfg.Duration), true
+}
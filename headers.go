@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// headerFuncs is functions of templated header values
+var headerFuncs = template.FuncMap{
+	"uuid":      newUUID,
+	"now":       func() string { return time.Now().UTC().Format(time.RFC3339) },
+	"unix":      func() int64 { return time.Now().Unix() },
+	"unixMilli": func() int64 { return time.Now().UnixNano() / int64(time.Millisecond) },
+	"env":       os.Getenv,
+	"hmacSHA256": func(key, msg string) string {
+		m := hmac.New(sha256.New, []byte(key))
+		_, _ = m.Write([]byte(msg))
+		return hex.EncodeToString(m.Sum(nil))
+	},
+}
+
+// headerData is data of templated header values, rendered per request
+type headerData struct {
+	// Name is scenario name
+	Name string
+	// URL is request URL, after weighted URL selection and path params
+	URL string
+	// Method is request method
+	Method string
+	// Seq is 0-based request number of scenario
+	Seq int
+}
+
+// isHeaderTemplate reports whether header value has template action
+func isHeaderTemplate(v string) bool {
+	return strings.Contains(v, "{{")
+}
+
+// parseHeaderTemplates parses templated values of headers and executes
+// them once to find errors at load. Values without template are set as
+// is
+func parseHeaderTemplates(s *Scenario) error {
+	for k, v := range s.Headers {
+		if !isHeaderTemplate(v) {
+			continue
+		}
+		t, err := template.New(k).Funcs(headerFuncs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return xerrors.Errorf("header %s: %w", k, err)
+		}
+		// unknown fields are found only by executing it
+		if err := t.Execute(ioutil.Discard, headerData{Name: s.Name, URL: s.URL, Method: "GET"}); err != nil {
+			return xerrors.Errorf("header %s: %w", k, err)
+		}
+		if s.headerTemplates == nil {
+			s.headerTemplates = make(map[string]*template.Template)
+		}
+		s.headerTemplates[k] = t
+	}
+	return nil
+}
+
+// setStaticHeaders sets headers without template to req
+func (s Scenario) setStaticHeaders(req *http.Request) {
+	for k, v := range s.Headers {
+		if _, ok := s.headerTemplates[k]; !ok {
+			setHeader(req, k, v)
+		}
+	}
+}
+
+// setTemplatedHeaders renders templated headers for req
+func (s Scenario) setTemplatedHeaders(req *http.Request) error {
+	if len(s.headerTemplates) == 0 {
+		return nil
+	}
+	data := headerData{Name: s.Name, URL: req.URL.String(), Method: req.Method, Seq: s.seq}
+	buf := bytes.Buffer{}
+	for k, t := range s.headerTemplates {
+		buf.Reset()
+		if err := t.Execute(&buf, data); err != nil {
+			return xerrors.Errorf("header %s: %w", k, err)
+		}
+		setHeader(req, k, buf.String())
+	}
+	return nil
+}
+
+// setHeader sets header, Host header sets request host
+func setHeader(req *http.Request, k, v string) {
+	if strings.EqualFold(k, "Host") {
+		req.Host = v
+		return
+	}
+	req.Header.Set(k, v)
+}
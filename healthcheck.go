@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// HealthCheck is request probed once before load
+type HealthCheck struct {
+	URL string `yaml:"url,omitempty"`
+	// Status is expected status code, 0 means any 2xx
+	Status int `yaml:"status,omitempty"`
+}
+
+// Probe sends health check request and checks status code
+func (h HealthCheck) Probe(ctx context.Context) error {
+	req, err := http.NewRequest("GET", h.URL, nil)
+	if err != nil {
+		return xerrors.Errorf("health check %s: %w", h.URL, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(httpTimeout)*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return xerrors.Errorf("health check %s: %w", h.URL, err)
+	}
+	_ = resp.Body.Close()
+
+	if h.Status == 0 {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return xerrors.Errorf("health check %s: status code is invalid: expected: 2xx, got: %v", h.URL, resp.StatusCode)
+		}
+		return nil
+	}
+	if resp.StatusCode != h.Status {
+		return xerrors.Errorf("health check %s: status code is invalid: expected: %v, got: %v", h.URL, h.Status, resp.StatusCode)
+	}
+	return nil
+}
+
+// readiness backoff bounds of WaitReady
+const (
+	readyMinBackoff = 500 * time.Millisecond
+	readyMaxBackoff = 5 * time.Second
+)
+
+// WaitReady probes health check with exponential backoff until it
+// passes or timeout elapses. It returns last probe error on timeout
+func (h HealthCheck) WaitReady(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := readyMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := h.Probe(ctx)
+		if err == nil {
+			return nil
+		}
+		resultLog.Printf("wait for ready: attempt %d: %s", attempt, err)
+		select {
+		case <-ctx.Done():
+			return xerrors.Errorf("not ready after %v: %w", timeout, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > readyMaxBackoff {
+			backoff = readyMaxBackoff
+		}
+	}
+}
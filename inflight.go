@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// inflightGauge tracks requests in flight of scenario. Average is time
+// weighted, accumulated on every change instead of sampled
+type inflightGauge struct {
+	mu    sync.Mutex
+	n     int
+	max   int
+	area  float64 // sum of n * seconds
+	start time.Time
+	last  time.Time
+}
+
+func newInflightGauge() *inflightGauge {
+	now := time.Now()
+	return &inflightGauge{start: now, last: now}
+}
+
+func (g *inflightGauge) add(delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.area += float64(g.n) * now.Sub(g.last).Seconds()
+	g.last = now
+	g.n += delta
+	if g.n > g.max {
+		g.max = g.n
+	}
+}
+
+// stats returns max and time weighted average of requests in flight
+func (g *inflightGauge) stats() (int, float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	area := g.area + float64(g.n)*now.Sub(g.last).Seconds()
+	elapsed := now.Sub(g.start).Seconds()
+	if elapsed <= 0 {
+		return g.max, 0
+	}
+	return g.max, area / elapsed
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// writeInflux writes reports in InfluxDB line protocol
+func writeInflux(w io.Writer, reports map[string]ScenarioReport, ts time.Time) error {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := reports[name]
+		tag := influxTagEscaper.Replace(name)
+		counts := []struct {
+			result string
+			count  int
+		}{
+			{"ok", r.SuccessCount},
+			{"validation_fail", r.ValidationFailCount},
+			{"request_fail", r.RequestFailCount},
+		}
+		for _, c := range counts {
+			if _, err := fmt.Fprintf(w, "splay_requests,scenario=%s,result=%s count=%di %d\n",
+				tag, c.result, c.count, ts.UnixNano()); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "splay_latency,scenario=%s p50_ms=%g,p95_ms=%g,p99_ms=%g,max_ms=%g,mean_ms=%g,stddev_ms=%g %d\n",
+			tag, ms(r.Latency.P50), ms(r.Latency.P95), ms(r.Latency.P99), ms(r.Latency.Max),
+			ms(r.Latency.Mean), ms(r.Latency.StdDev), ts.UnixNano()); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "splay_ttfb,scenario=%s p50_ms=%g,p95_ms=%g,p99_ms=%g,max_ms=%g %d\n",
+			tag, ms(r.TTFB.P50), ms(r.TTFB.P95), ms(r.TTFB.P99), ms(r.TTFB.Max), ts.UnixNano()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushInflux posts line protocol to InfluxDB /write endpoint
+func pushInflux(endpoint, db string, body []byte) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return xerrors.Errorf("influx url: %w", err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/write"
+	u.RawQuery = url.Values{"db": {db}, "precision": {"ns"}}.Encode()
+
+	resp, err := http.Post(u.String(), "text/plain; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("influx push: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("influx push: status code is invalid: %v: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ms converts duration to milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// resultStream is set by -o jsonl
+var resultStream *jsonlWriter
+
+// jsonlWriter writes each request result as one JSON line as it
+// finishes. Lines are written whole under lock, so workers never
+// interleave them
+type jsonlWriter struct {
+	shard string
+
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	f   *os.File
+	err error
+}
+
+// newJSONLWriter writes to path, or stdout when path is empty
+func newJSONLWriter(path, shard string) (*jsonlWriter, error) {
+	var out io.Writer = os.Stdout
+	var f *os.File
+	if path != "" {
+		var err error
+		if f, err = os.Create(path); err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	return &jsonlWriter{shard: shard, w: w, enc: json.NewEncoder(w), f: f}, nil
+}
+
+// write writes result line and flushes it, so that pipe reader sees it
+// in real time. First error is kept and returned by Close
+func (j *jsonlWriter) write(r Result, end time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return
+	}
+	if err := j.enc.Encode(newRequestEvent(r, end, j.shard)); err != nil {
+		j.err = err
+		return
+	}
+	j.err = j.w.Flush()
+}
+
+// Close closes file and returns first write error
+func (j *jsonlWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f != nil {
+		if err := j.f.Close(); err != nil && j.err == nil {
+			j.err = err
+		}
+	}
+	return j.err
+}
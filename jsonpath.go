@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// jsonPath is parsed subset of JSONPath: $, .key and [index]
+type jsonPath []interface{}
+
+// parseJSONPath parses path like $.data.items[0].id
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, xerrors.Errorf("json path must start with $: %s", path)
+	}
+	var p jsonPath
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, xerrors.Errorf("json path has empty key: %s", path)
+			}
+			p = append(p, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, xerrors.Errorf("json path has unclosed [: %s", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, xerrors.Errorf("json path has invalid index: %s", path)
+			}
+			p = append(p, i)
+			rest = rest[end+1:]
+		default:
+			return nil, xerrors.Errorf("json path is invalid: %s", path)
+		}
+	}
+	return p, nil
+}
+
+// lookup returns value at path of decoded JSON, false when it does not exist
+func (p jsonPath) lookup(v interface{}) (interface{}, bool) {
+	for _, elem := range p {
+		switch e := elem.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[e]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || e >= len(a) {
+				return nil, false
+			}
+			v = a[e]
+		}
+	}
+	return v, true
+}
+
+// validateJSONPath checks json_path settings of validate
+func (v Validate) validateJSONPath() error {
+	if v.JSONPath == nil {
+		if v.JSONMin != nil || v.JSONMax != nil {
+			return xerrors.New("json_min and json_max need json_path")
+		}
+		return nil
+	}
+	if _, err := parseJSONPath(*v.JSONPath); err != nil {
+		return err
+	}
+	if v.JSONMin != nil && v.JSONMax != nil && *v.JSONMin > *v.JSONMax {
+		return xerrors.Errorf("json_min is greater than json_max: %v > %v", *v.JSONMin, *v.JSONMax)
+	}
+	return nil
+}
+
+// checkJSONPath validates value at json_path of response body
+func (v Validate) checkJSONPath(res *response) error {
+	path, err := parseJSONPath(*v.JSONPath)
+	if err != nil {
+		return err
+	}
+	var body interface{}
+	if err := json.Unmarshal(res.body, &body); err != nil {
+		return xerrors.Errorf("decode json body: %w", err)
+	}
+	value, ok := path.lookup(body)
+	if !ok {
+		return xerrors.Errorf("json path %s does not exist", *v.JSONPath)
+	}
+	if v.JSONMin == nil && v.JSONMax == nil {
+		return nil
+	}
+	n, ok := value.(float64)
+	if !ok {
+		b, _ := json.Marshal(value)
+		return xerrors.Errorf("json path %s is not a number: %s", *v.JSONPath, b)
+	}
+	if v.JSONMin != nil && n < *v.JSONMin {
+		return xerrors.Errorf("json path %s is invalid: expected min: %v, got: %v", *v.JSONPath, *v.JSONMin, n)
+	}
+	if v.JSONMax != nil && n > *v.JSONMax {
+		return xerrors.Errorf("json path %s is invalid: expected max: %v, got: %v", *v.JSONPath, *v.JSONMax, n)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes reports as JUnit XML. Each scenario is testcase failed
+// by its verdict, and each assertion is testcase too. elapsed is time of
+// whole run, scenario testcase has its own run time
+func writeJUnit(w io.Writer, reports map[string]ScenarioReport, elapsed time.Duration, assertNo5xx bool) error {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	suite := junitTestSuite{Name: "splay", Time: junitTime(elapsed)}
+	for _, name := range names {
+		r := reports[name]
+		classname := "splay." + name
+
+		c := junitTestCase{
+			Name:      name,
+			ClassName: classname,
+			Time:      junitTime(r.Elapsed),
+			SystemOut: fmt.Sprintf("success: %d, validation fail: %d, request fail: %d\np50: %v, p95: %v, p99: %v, max: %v\n",
+				r.SuccessCount, r.ValidationFailCount, r.RequestFailCount,
+				r.Latency.P50, r.Latency.P95, r.Latency.P99, r.Latency.Max),
+		}
+		if !r.Passed {
+			var reasons []string
+			if r.AbortReason != "" {
+				reasons = append(reasons, "abort: "+r.AbortReason)
+			}
+			reasons = append(reasons, r.AssertFailures...)
+			c.Failure = &junitFailure{
+				Message: strings.Join(reasons, "; "),
+				Type:    "verdict",
+				Body:    formatErrorSamples(r.ErrorSamples),
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+
+		for _, a := range r.AssertResults {
+			c := junitTestCase{Name: name + " assert " + a.Name, ClassName: classname, Time: "0"}
+			if a.Failure != "" {
+				c.Failure = &junitFailure{Message: a.Failure, Type: "assert", Body: formatErrorSamples(r.ErrorSamples)}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		if assertNo5xx {
+			c := junitTestCase{Name: name + " assert no 5xx", ClassName: classname, Time: "0"}
+			if n := count5xx(r.StatusCounts); n > 0 {
+				c.Failure = &junitFailure{Message: fmt.Sprintf("expected: 0, got: %d", n), Type: "assert"}
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+	}
+	for _, c := range suite.Cases {
+		suite.Tests++
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// formatErrorSamples formats error messages with count, most frequent first
+func formatErrorSamples(samples map[string]int) string {
+	msgs := make([]string, 0, len(samples))
+	for msg := range samples {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		if samples[msgs[i]] != samples[msgs[j]] {
+			return samples[msgs[i]] > samples[msgs[j]]
+		}
+		return msgs[i] < msgs[j]
+	})
+	b := strings.Builder{}
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "%d x %s\n", samples[msg], msg)
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// resultLog writes manifest and result summary. It is kept on stderr
+// even when request logs go to file
+var resultLog = log.New(os.Stderr, "", log.LstdFlags)
+
+// reopenFile is log file writer which can be reopened after rotation
+type reopenFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openLogFile(path string) (*reopenFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, xerrors.Errorf("create log dir: %w", err)
+	}
+	w := &reopenFile{path: path}
+	if err := w.Reopen(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Reopen closes current file and opens path again
+func (w *reopenFile) Reopen() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return xerrors.Errorf("open log file: %w", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f != nil {
+		_ = w.f.Close()
+	}
+	w.f = f
+	return nil
+}
+
+func (w *reopenFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Write(p)
+}
+
+// Close closes current file
+func (w *reopenFile) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// logOutput returns request log destination, "stderr" or "stdout"
+func logOutput(dest string) (io.Writer, error) {
+	switch dest {
+	case "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	default:
+		return nil, xerrors.Errorf("unknown log destination: %s", dest)
+	}
+}
+
+// throttledWriter passes at most rate lines per second to w. Each Write
+// is a line of log.Logger, dropped lines are summarized every second
+type throttledWriter struct {
+	rl   *rate.Limiter
+	stop chan struct{}
+	done chan struct{}
+
+	mu         sync.Mutex
+	w          io.Writer
+	summary    *log.Logger
+	suppressed int
+}
+
+func newThrottledWriter(w io.Writer, perSecond int) *throttledWriter {
+	t := &throttledWriter{
+		rl:   rate.NewLimiter(rate.Limit(perSecond), perSecond),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		w:    w,
+	}
+	t.summary = log.New(lockedWriter{t}, "", log.LstdFlags)
+	go t.run()
+	return t
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.rl.Allow() {
+		t.suppressed++
+		return len(p), nil
+	}
+	return t.w.Write(p)
+}
+
+func (t *throttledWriter) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			t.report()
+			return
+		case <-ticker.C:
+			t.report()
+		}
+	}
+}
+
+// report writes count of lines suppressed since last report
+func (t *throttledWriter) report() {
+	t.mu.Lock()
+	n := t.suppressed
+	t.suppressed = 0
+	t.mu.Unlock()
+	if n > 0 {
+		t.summary.Printf("%d lines suppressed by -log-rate", n)
+	}
+}
+
+// Close stops summary and reports lines suppressed last
+func (t *throttledWriter) Close() {
+	close(t.stop)
+	<-t.done
+}
+
+// lockedWriter writes to w of throttledWriter bypassing rate limit
+type lockedWriter struct {
+	t *throttledWriter
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.t.mu.Lock()
+	defer l.t.mu.Unlock()
+	return l.t.w.Write(p)
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"math"
+	"math/rand"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -41,26 +47,135 @@ func init() {
 
 // ScenarioData is scenario yaml file structure
 type ScenarioData struct {
-	Scenarios []Scenario `yaml:",flow"`
+	// Transports is named transports scenarios reference by transport
+	Transports map[string]TransportConfig `yaml:"transports"`
+	Scenarios  []Scenario                 `yaml:",flow"`
 }
 
 // Scenario is scenario data
 type Scenario struct {
-	Name string `yaml:"name"`
-	URL  string `yaml:"url"`
+	Name string `yaml:"name,omitempty"`
+	URL  string `yaml:"url,omitempty"`
+	// URLs is weighted URLs selected randomly per request instead of URL
+	URLs []WeightedURL `yaml:"urls,omitempty"`
+	// PathParams is sequences substituted into {name} of URL, cycling
+	// through values request by request
+	PathParams map[string]PathParam `yaml:"path_params,omitempty"`
+	// urlTemplate is URL before path params are substituted
+	urlTemplate string
+	// urlList is URLs of -urls-file requested round-robin
+	urlList []string
+	// inflight is gauge of scenario run, set when request is generated
+	inflight *inflightGauge
+	// seq is 0-based request number, set when request is generated
+	seq int
 
-	Period     *int    `yaml:"period"`
-	Count      *int    `yaml:"count"`
-	Throughput float64 `yaml:"throughput"`
+	// Headers is request headers. Values with {{ }} are text/template
+	// rendered per request, others are set as is
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	headerTemplates map[string]*template.Template
 
-	Validates []Validate `yaml:",flow"`
+	Period *int `yaml:"period,omitempty"`
+	Count  *int `yaml:"count,omitempty"`
+	// Throughput is required, 0 or unlimited sends as fast as workers allow
+	Throughput *Throughput `yaml:"throughput,omitempty"`
+	// Serial runs scenario with single worker, so requests never overlap
+	Serial bool `yaml:"serial,omitempty"`
+	// RandomOffset delays start of scenario by random phase within one
+	// request interval, so that identical scenarios do not tick together
+	RandomOffset bool `yaml:"random_offset,omitempty"`
+	// RampDown is final window of period where throughput decreases
+	// linearly to near zero
+	RampDown *time.Duration `yaml:"ramp_down,omitempty"`
+	// Weight is ratio of requests in -mixed mode, default is throughput
+	Weight *float64 `yaml:"weight,omitempty"`
+
+	// Protocol is "http" (default) or "grpc-web"
+	Protocol string `yaml:"protocol,omitempty"`
+	// GRPCMessage is base64 encoded message sent with grpc-web protocol
+	GRPCMessage string `yaml:"grpc_message,omitempty"`
+
+	// IdempotencyKey sets unique Idempotency-Key header per request
+	IdempotencyKey bool `yaml:"idempotency_key,omitempty"`
+	// CorrelationID sets unique ID per request to CorrelationHeader
+	// (default X-Request-Id), the ID is logged on failure
+	CorrelationID     bool   `yaml:"correlation_id,omitempty"`
+	CorrelationHeader string `yaml:"correlation_header,omitempty"`
+
+	// LatencyAbort stops scenario when latency stays too high
+	LatencyAbort *LatencyAbort `yaml:"latency_abort,omitempty"`
+	// Paginate follows next page links in the same iteration
+	Paginate *Paginate `yaml:"paginate,omitempty"`
+
+	// HealthCheck is probed before load, run is aborted when it fails
+	HealthCheck *HealthCheck `yaml:"healthcheck,omitempty"`
+
+	// AggregateHeader is response header whose values are counted in report
+	AggregateHeader string `yaml:"aggregate_header,omitempty"`
+
+	// MaxRedirects is max redirect hops followed, more is request fail
+	MaxRedirects *int `yaml:"max_redirects,omitempty"`
+
+	// EtagRevalidate sends ETag and Last-Modified of previous response
+	// from the same worker back as If-None-Match and If-Modified-Since,
+	// and expects 304
+	EtagRevalidate bool `yaml:"etag_revalidate,omitempty"`
+
+	// Transport is name of transport in transports, default transport is
+	// used when it is empty
+	Transport string `yaml:"transport,omitempty"`
+	transport *namedTransport
+
+	// LatencyStatus is status codes latency stats are computed from, all
+	// requests are still counted
+	LatencyStatus []int `yaml:"latency_status,omitempty"`
+
+	// ExpectedStatus is acceptable status codes, others are validation
+	// fail even without validates
+	ExpectedStatus []int `yaml:"expected_status,omitempty"`
+
+	// Success is combined rule of status and body a response must meet to
+	// be success, after expected_status and before validates
+	Success *SuccessRule `yaml:"success,omitempty"`
+
+	Validates []Validate `yaml:",flow,omitempty"`
+	Assert    *Assert    `yaml:"assert,omitempty"`
+
+	// Phase is main (default) for load, or setup and teardown sent once
+	// before and after main scenarios
+	Phase string `yaml:"phase,omitempty"`
 }
 
-// Validate is scenario validation structure
-type Validate struct {
-	Name string `yaml:"name"`
+// Scenario protocols
+const (
+	protocolHTTP    = "http"
+	protocolGRPCWeb = "grpc-web"
+)
+
+// Assert is scenario acceptance criteria evaluated after the run
+type Assert struct {
+	// SuccessRate is minimum ratio (0.0 - 1.0) of successful requests
+	SuccessRate *float64       `yaml:"success_rate,omitempty"`
+	P95         *time.Duration `yaml:"p95,omitempty"`
+	// MaxErrors is maximum count of validation fail and request fail
+	MaxErrors *int `yaml:"max_errors,omitempty"`
+	// MaxCV is maximum coefficient of variation (stddev / mean) of latency
+	MaxCV *float64 `yaml:"max_cv,omitempty"`
+	// MinAchievedRPS is minimum AchievedRPS, fails when load could not
+	// be driven
+	MinAchievedRPS *float64 `yaml:"min_achieved_rps,omitempty"`
+	// MaxWindowErrorRate is maximum ratio (0.0 - 1.0) of validation fail
+	// and request fail in any ErrorRateWindow (default 5s) of the run
+	MaxWindowErrorRate *float64       `yaml:"max_window_error_rate,omitempty"`
+	ErrorRateWindow    *time.Duration `yaml:"error_rate_window,omitempty"`
+}
 
-	StatusCode *int `yaml:"status_code"`
+// errorRateWindow returns window of worst error rate
+func (a *Assert) errorRateWindow() time.Duration {
+	if a == nil || a.ErrorRateWindow == nil {
+		return defaultErrorRateWindow
+	}
+	return *a.ErrorRateWindow
 }
 
 // ResultState is state of scenario result
@@ -73,209 +188,1713 @@ const (
 	ResultRequestFail
 )
 
+// Result is single request result
+type Result struct {
+	Name  string
+	URL   string
+	State ResultState
+	// Latency is response time, zero when request failed
+	Latency time.Duration
+	// TTFB is time to first response byte, part of Latency
+	TTFB time.Duration
+	// ErrorKind is kind of transport error when request failed
+	ErrorKind string
+	// Pages is count of responses, more than 1 with paginate
+	Pages int
+	// StatusCode is status of last response, zero when request failed
+	StatusCode int
+	// Error is message of failure
+	Error string
+	// ClockSkew is server Date minus local time, valid when HasClockSkew
+	ClockSkew    time.Duration
+	HasClockSkew bool
+	// HeaderValue is aggregate_header value of last response
+	HeaderValue string
+	// RequestID is correlation ID of last request, with correlation_id
+	RequestID string
+	// URLTemplate is URL before path_params substitution, only with
+	// path_params
+	URLTemplate string
+	// Revalidated is true when request was conditional with
+	// etag_revalidate, and NotModified when it got 304
+	Revalidated bool
+	NotModified bool
+}
+
 // LoadScenarioFile read file and map ScenarioData
 func LoadScenarioFile(in io.Reader) (*ScenarioData, error) {
-	bytes, err := ioutil.ReadAll(in)
+	s := ScenarioData{}
+	err := StreamScenarioFile(in, func(scenario Scenario) error {
+		s.Scenarios = append(s.Scenarios, scenario)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return &s, nil
+}
 
-	s := ScenarioData{}
-
-	if err := yaml.Unmarshal(bytes, &s); err != nil {
-		return nil, err
+// StreamScenarioFile decodes scenario file and calls fn for each validated
+// scenario. The file is decoded from reader without reading it all, and
+// it can consist of multiple YAML documents ("---"), each has scenarios.
+// Only one document is held in memory at a time. Scenarios can reference
+// transports defined in the same or preceding documents.
+func StreamScenarioFile(in io.Reader, fn func(Scenario) error) error {
+	dec := yaml.NewDecoder(in)
+	transports := transportRegistry{}
+	for {
+		doc := ScenarioData{}
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := transports.add(doc.Transports); err != nil {
+			return err
+		}
+		for _, scenario := range doc.Scenarios {
+			if err := transports.resolve(&scenario); err != nil {
+				return xerrors.Errorf("scenario %s: %w", scenario.Name, err)
+			}
+			if err := parseHeaderTemplates(&scenario); err != nil {
+				return xerrors.Errorf("scenario %s: %w", scenario.Name, err)
+			}
+			if err := validateScenario(scenario); err != nil {
+				return xerrors.Errorf("scenario %s: %w", scenario.Name, err)
+			}
+			if err := fn(scenario); err != nil {
+				return err
+			}
+		}
 	}
+}
 
-	return &s, nil
+// validateScenario checks scenario settings which can be checked before run
+func validateScenario(s Scenario) error {
+	if err := validatePhase(s); err != nil {
+		return err
+	}
+	switch s.Protocol {
+	case "", protocolHTTP, protocolGRPCWeb:
+	default:
+		return xerrors.Errorf("unknown protocol: %s", s.Protocol)
+	}
+	if s.Paginate != nil {
+		if s.Protocol == protocolGRPCWeb {
+			return xerrors.New("paginate cannot be used with grpc-web")
+		}
+		if err := s.Paginate.validate(); err != nil {
+			return xerrors.Errorf("paginate: %w", err)
+		}
+	}
+	if s.EtagRevalidate && (s.Paginate != nil || s.Protocol == protocolGRPCWeb) {
+		return xerrors.New("etag_revalidate cannot be used with paginate or grpc-web")
+	}
+	if err := validatePathParams(s); err != nil {
+		return err
+	}
+	if s.Success != nil {
+		if err := s.Success.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Assert != nil && s.Assert.ErrorRateWindow != nil && *s.Assert.ErrorRateWindow < time.Second {
+		return xerrors.Errorf("assert: error_rate_window must be at least 1s: %v", *s.Assert.ErrorRateWindow)
+	}
+	for _, v := range s.Validates {
+		if err := v.validateCharset(); err != nil {
+			return xerrors.Errorf("%s: %w", v.Name, err)
+		}
+		if err := v.validateJSONPath(); err != nil {
+			return xerrors.Errorf("%s: %w", v.Name, err)
+		}
+	}
+	if s.MaxRedirects != nil && *s.MaxRedirects < 0 {
+		return xerrors.Errorf("max_redirects must not be negative: %v", *s.MaxRedirects)
+	}
+	if s.LatencyAbort != nil && s.LatencyAbort.P95 <= 0 {
+		return xerrors.New("latency_abort: p95 must be positive")
+	}
+	if s.Throughput == nil && !s.isHook() {
+		return xerrors.Errorf("throughput is required, use %s for no rate limit", unlimitedThroughput)
+	}
+	if s.RampDown != nil {
+		if s.rps().unlimited() {
+			return xerrors.New("ramp_down cannot be used with unlimited throughput")
+		}
+		if s.Period == nil {
+			return xerrors.New("ramp_down requires period")
+		}
+		if *s.RampDown <= 0 || *s.RampDown > time.Duration(*s.Period)*time.Second {
+			return xerrors.Errorf("ramp_down must be within period: %v", *s.RampDown)
+		}
+	}
+	if s.URL != "" && len(s.URLs) > 0 {
+		return xerrors.New("url and urls cannot be used together")
+	}
+	if s.Weight != nil && *s.Weight <= 0 {
+		return xerrors.Errorf("weight must be positive: %v", *s.Weight)
+	}
+	for _, u := range s.URLs {
+		if u.Weight <= 0 {
+			return xerrors.Errorf("urls: weight of %s must be positive: %v", u.URL, u.Weight)
+		}
+	}
+	return nil
 }
 
-func scenarioWorker(
-	ctx context.Context,
-	scenarioCh <-chan Scenario,
-	done chan<- struct{},
-	reportCh chan<- ResultState) {
-L:
+// runRequest sends one scenario request and validates response. With
+// paginate, next pages are followed and validated in the same iteration.
+// cache is validators of etag_revalidate held by the worker
+func runRequest(ctx context.Context, s Scenario, cache etagCache) Result {
+	result := Result{Name: s.Name, URL: s.URL, URLTemplate: s.urlTemplate}
+	fail := func(state ResultState, err error) Result {
+		if result.RequestID != "" {
+			log.Printf("[%s] Error: %s (%s: %s)", s.Name, err, s.correlationHeader(), result.RequestID)
+		} else {
+			log.Printf("[%s] Error: %s", s.Name, err)
+		}
+		result.State = state
+		result.Error = err.Error()
+		return result
+	}
+
+	pageURL := s.URL
+	items := 0
 	for {
-		var s Scenario
-		select {
-		case <-ctx.Done():
-			return
-		case s = <-scenarioCh:
+		if s.hasCorrelationID() {
+			id, err := newUUID()
+			if err != nil {
+				return fail(ResultRequestFail, err)
+			}
+			result.RequestID = id
 		}
-		req, err := http.NewRequest("GET", s.URL, nil)
+		cond := cache.validator(s)
+		res, err := fetch(ctx, s, pageURL, result.RequestID, cond)
 		if err != nil {
-			log.Printf("[%s] Error: %s", s.Name, err)
-			reportCh <- ResultRequestFail
-			done <- struct{}{}
-			return
+			result.ErrorKind = classifyError(err)
+			if connectFail != nil && isConnectError(err) {
+				connectFail.fail(xerrors.Errorf("scenario %s: %w", s.Name, err))
+			}
+			return fail(ResultRequestFail, err)
+		}
+		result.Latency += res.latency
+		result.TTFB += res.ttfb
+		result.Pages++
+		result.StatusCode = res.StatusCode
+		if s.AggregateHeader != "" {
+			result.HeaderValue = res.Header.Get(s.AggregateHeader)
+			if _, ok := res.Header[http.CanonicalHeaderKey(s.AggregateHeader)]; !ok {
+				result.HeaderValue = missingHeaderValue
+			}
+		}
+		if res.hasClockSkew {
+			result.ClockSkew, result.HasClockSkew = res.clockSkew, true
+		}
+
+		if s.EtagRevalidate {
+			cache.store(s, res.Response)
+			if cond.ok() {
+				result.Revalidated = true
+				if res.StatusCode != http.StatusNotModified {
+					return fail(ResultValidationFail, xerrors.Errorf("status code is not expected on revalidation: expected: 304, got: %v", res.StatusCode))
+				}
+				// 304 has no body to validate
+				result.NotModified = true
+				break
+			}
+		}
+		if !s.isExpectedStatus(res.StatusCode) {
+			return fail(ResultValidationFail, xerrors.Errorf("status code is not expected: expected: %v, got: %v", s.ExpectedStatus, res.StatusCode))
+		}
+		if s.Success != nil {
+			if err := s.Success.check(res); err != nil {
+				return fail(ResultValidationFail, err)
+			}
+		}
+		for _, v := range s.Validates {
+			if err := v.check(ctx, res); err != nil {
+				if v.Message != "" {
+					err = xerrors.New(v.Message)
+				}
+				return fail(ResultValidationFail, xerrors.Errorf("%s: %w", v.Name, err))
+			}
+		}
+
+		if s.Paginate != nil && s.Paginate.Items != "" {
+			n, err := s.Paginate.pageItems(res)
+			if err != nil {
+				return fail(ResultValidationFail, err)
+			}
+			items += n
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(httpTimeout)*time.Second)
-		req = req.WithContext(ctx)
-		resp, err := http.DefaultClient.Do(req)
+		if s.Paginate == nil || result.Pages >= s.Paginate.maxPages() {
+			break
+		}
+		next, ok, err := s.Paginate.nextPage(res)
 		if err != nil {
-			log.Printf("[%s] Error: %s", s.Name, err)
-			reportCh <- ResultRequestFail
-			cancel()
-			done <- struct{}{}
-			return
+			return fail(ResultValidationFail, err)
+		}
+		if !ok {
+			break
 		}
-		_ = resp.Body.Close()
+		pageURL = next
+	}
+	if s.Paginate != nil {
+		if err := s.Paginate.checkItems(items); err != nil {
+			return fail(ResultValidationFail, err)
+		}
+	}
+	log.Printf("[%s] Success", s.Name)
+	result.State = ResultOK
+	return result
+}
 
-		for _, v := range s.Validates {
-			// validate
-			if v.StatusCode != nil && resp.StatusCode != *v.StatusCode {
-				err := xerrors.Errorf("%s: status code is invalid: expected: %v, got: %v", v.Name, *v.StatusCode, resp.StatusCode)
-				reportCh <- ResultValidationFail
-				log.Printf("[%s] Error: %s", s.Name, err)
-				cancel()
-				continue L
+// fetch sends request to url and reads response for validations.
+// requestID is set to correlation header when not empty, and cond is
+// conditional headers when it has validators
+func fetch(ctx context.Context, s Scenario, url, requestID string, cond cacheValidator) (*response, error) {
+	req, err := prepareRequest(s, url, requestID)
+	if err != nil {
+		return nil, err
+	}
+	cond.set(req)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(httpTimeout)*time.Second)
+	defer cancel()
+	// with redirects, first byte of the last response is kept
+	var firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+	start := time.Now()
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res := &response{Response: resp}
+	if !firstByte.IsZero() {
+		res.ttfb = firstByte.Sub(start)
+	}
+	if measureClockSkew {
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			res.clockSkew, res.hasClockSkew = date.Sub(time.Now()), true
+		}
+	}
+	if s.Protocol == protocolGRPCWeb {
+		res.grpcStatus, res.grpcErr = readGRPCWebStatus(resp)
+	} else if s.needsCompression() {
+		err = readCompressedBody(res)
+	} else if s.needsBody() {
+		res.body, err = ioutil.ReadAll(resp.Body)
+	} else {
+		// unread body closes connection instead of returning it to pool
+		err = drainBody(resp.Body)
+	}
+	_ = resp.Body.Close()
+	res.latency = time.Since(start)
+	if err != nil {
+		return nil, &bodyReadError{err: err}
+	}
+	return res, nil
+}
+
+// workers returns worker count of scenario, 1 when serial
+func (s Scenario) workers() int {
+	if s.Serial {
+		return 1
+	}
+	return httpWorkerNum
+}
+
+// defaultCorrelationHeader is header of correlation ID by default
+const defaultCorrelationHeader = "X-Request-Id"
+
+// hasCorrelationID reports whether requests are tagged with correlation ID
+func (s Scenario) hasCorrelationID() bool {
+	return s.CorrelationID || s.CorrelationHeader != ""
+}
+
+// correlationHeader returns header name correlation ID is set to
+func (s Scenario) correlationHeader() string {
+	if s.CorrelationHeader != "" {
+		return s.CorrelationHeader
+	}
+	return defaultCorrelationHeader
+}
+
+// errTooManyRedirects is returned when redirects exceeded max_redirects
+var errTooManyRedirects = xerrors.New("too many redirects")
+
+// prepareRequest creates request of scenario to url with per request
+// headers set
+func prepareRequest(s Scenario, url, requestID string) (*http.Request, error) {
+	req, err := newRequest(s, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setTemplatedHeaders(req); err != nil {
+		return nil, err
+	}
+	if s.IdempotencyKey {
+		key, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if requestID != "" {
+		req.Header.Set(s.correlationHeader(), requestID)
+	}
+	if s.needsCompression() {
+		setAcceptGzip(req)
+	}
+	return req, nil
+}
+
+// client returns http client of scenario
+func (s Scenario) client() *http.Client {
+	if s.MaxRedirects == nil && s.transport == nil {
+		return http.DefaultClient
+	}
+	c := &http.Client{}
+	if s.transport != nil {
+		c.Transport = s.transport.transport
+	}
+	if s.MaxRedirects != nil {
+		max := *s.MaxRedirects
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > max {
+				return xerrors.Errorf("stopped after %d redirects: %w", max, errTooManyRedirects)
 			}
+			return nil
 		}
-		log.Printf("[%s] Success", s.Name)
-		reportCh <- ResultOK
-		cancel()
-		done <- struct{}{}
+	}
+	return c
+}
+
+// isExpectedStatus reports whether status code is in expected_status,
+// any status is expected when it is not set
+func (s Scenario) isExpectedStatus(code int) bool {
+	if len(s.ExpectedStatus) == 0 {
+		return true
+	}
+	for _, c := range s.ExpectedStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// needsBody reports whether response body is read
+func (s Scenario) needsBody() bool {
+	if s.Paginate != nil || (s.Success != nil && s.Success.hasBodyCondition()) {
+		return true
+	}
+	for _, v := range s.Validates {
+		if v.needsBody() {
+			return true
+		}
+	}
+	return false
+}
+
+// isHeaderTooLarge reports whether err is caused by MaxResponseHeaderBytes.
+// net/http does not export the error, so it is detected by message
+func isHeaderTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "server response headers exceeded")
+}
+
+func scenarioWorker(
+	ctx context.Context,
+	workerID int,
+	scenarioCh <-chan Scenario,
+	reportCh chan<- Result) {
+	cache := etagCache{}
+	for s := range scenarioCh {
+		// after hard cancel, queued requests are dropped
+		if ctx.Err() != nil {
+			continue
+		}
+		start := time.Now()
+		if s.inflight != nil {
+			s.inflight.add(1)
+		}
+		result := runRequest(ctx, s, cache)
+		if s.inflight != nil {
+			s.inflight.add(-1)
+		}
+		if ctx.Err() != nil {
+			continue
+		}
+		end := time.Now()
+		if tracer != nil {
+			tracer.record(workerID, result, start, end)
+		}
+		if events != nil {
+			events.publish(result, end)
+		}
+		if resultStream != nil {
+			resultStream.write(result, end)
+		}
+		reportCh <- result
 	}
 }
 
+// minDuration is set by -min-duration. Scenario keeps issuing requests
+// after count until it elapses
+var minDuration time.Duration
+
+// excludeStatusFromLatency is set by -exclude-status-from-latency
+var excludeStatusFromLatency bool
+
+// measureClockSkew is set by -clock-skew
+var measureClockSkew bool
+
+// connectFail is set by -fail-fast-on-connect
+var connectFail *failFast
+
+// failFast cancels run on first error it is given, and keeps the error
+type failFast struct {
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// fail records err and cancels run, only first error is kept
+func (f *failFast) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return
+	}
+	f.err = err
+	f.cancel()
+}
+
+// Err returns first error, nil when run was not cancelled by it
+func (f *failFast) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// workerSeq numbers workers across scenarios for trace
+var workerSeq int64
+
 // ScenarioReport is aggregated scenario result
 type ScenarioReport struct {
 	SuccessCount        int
 	ValidationFailCount int
 	RequestFailCount    int
+	// HeaderTooLargeCount is request fail by too large response header
+	HeaderTooLargeCount int
+	// BodyReadFailCount is request fail while reading body after response
+	// header was received
+	BodyReadFailCount int
+	// RevalidateCount is conditional requests of etag_revalidate, and
+	// NotModifiedCount is those answered with 304
+	RevalidateCount  int
+	NotModifiedCount int
+	// ErrorBreakdown is request fail count per error kind
+	ErrorBreakdown map[string]int
+	// StatusCounts is response count per status code
+	StatusCounts map[int]int
+
+	Latency LatencyStats
+	// TTFB is time to first byte stats of the same responses as Latency
+	TTFB LatencyStats
+	// UnfilteredLatency is latency of all responses, only when Latency is
+	// filtered by latency_status or -exclude-status-from-latency
+	UnfilteredLatency *LatencyStats
+	// MaxInflight and AvgInflight are max and time weighted average of
+	// requests in flight
+	MaxInflight int
+	AvgInflight float64
+	// RequestedRPS is configured throughput
+	RequestedRPS float64
+	// AchievedRPS is completed requests per second of scenario run time
+	AchievedRPS float64
+	// URLCounts is request count per URL, only when urls is set
+	URLCounts map[string]int
+	// DistinctURLs is count of distinct URLs requested, only with
+	// path_params
+	DistinctURLs int
+	// HeaderCounts is response count per aggregate_header value, bounded
+	// by maxHeaderValues
+	HeaderCounts map[string]int
+	// HeaderOtherCount is responses whose value was not tracked in
+	// HeaderCounts because of the bound
+	HeaderOtherCount int
+	// AggregateHeader is name of header HeaderCounts is of
+	AggregateHeader string
+	// AvgPages is average pages followed per iteration, only with paginate
+	AvgPages float64
+	// AvgClockSkewMs is average of server Date minus local time, only
+	// with -clock-skew and responses with Date header
+	AvgClockSkewMs float64
+	// ClockSkewSamples is count of responses AvgClockSkewMs is from
+	ClockSkewSamples int
+
+	// WorstWindowErrorRate is highest error rate of any ErrorRateWindow
+	// of the run, which starts at WorstWindowAt from scenario start
+	WorstWindowErrorRate float64
+	WorstWindowAt        time.Duration
+	ErrorRateWindow      time.Duration
+
+	// AbortReason is set when scenario was aborted by latency_abort
+	AbortReason string
+	// Cancelled is true when run was cancelled before scenario finished,
+	// by SIGINT or -max-wallclock
+	Cancelled bool
+	// Elapsed is run time of scenario
+	Elapsed time.Duration
+
+	// Passed is verdict of scenario assert, true when assert is not set
+	// and scenario was not aborted
+	Passed         bool
+	AssertResults  []AssertResult
+	AssertFailures []string
+
+	// ErrorSamples is count of distinct error messages, bounded by
+	// maxErrorSamples
+	ErrorSamples map[string]int
 }
 
-// ScenarioRun runs scenario with context
-func ScenarioRun(ctx context.Context, s Scenario) ScenarioReport {
-	rl := rate.NewLimiter(rate.Limit(s.Throughput), 1)
+// maxErrorSamples is max distinct error messages kept in report
+const maxErrorSamples = 10
 
-	rlCh := make(chan struct{})
-	go func() {
-		defer close(rlCh)
-		for {
-			err := rl.Wait(ctx)
-			if err != nil {
-				return
+// maxHeaderValues is max distinct aggregate_header values kept in report
+const maxHeaderValues = 50
+
+// missingHeaderValue is counted when response has no aggregate_header
+const missingHeaderValue = "(missing)"
+
+// reportBuilder aggregates results of scenario into ScenarioReport
+type reportBuilder struct {
+	s Scenario
+	// started is when scenario run started, for AchievedRPS
+	started time.Time
+	// resumed is requests completed by previous run, with -resume
+	resumed int
+	// inflight is requests in flight, updated by workers
+	inflight *inflightGauge
+	// errorWindow is per second counts for worst window error rate
+	errorWindow *errorWindow
+
+	// mu guards counts read by checkpoint during run
+	mu                                   sync.Mutex
+	success, validationFail, requestFail int
+	headerTooLarge                       int
+	bodyReadFail                         int
+	revalidated, notModified             int
+	pages, paged                         int
+	clockSkewSum                         time.Duration
+	clockSkewSamples                     int
+	errorBreakdown                       map[string]int
+	statusCounts                         map[int]int
+	abortReason                          string
+	errorSamples                         map[string]int
+	latencies                            []time.Duration
+	ttfbs                                []time.Duration
+	unfilteredLatencies                  []time.Duration
+	// window is latencies since last tick, only with -timeseries-file
+	window       []time.Duration
+	urlCounts    map[string]int
+	headerCounts map[string]int
+	distinctURLs map[string]struct{}
+	headerOther  int
+}
+
+func newReportBuilder(s Scenario) *reportBuilder {
+	b := &reportBuilder{
+		s:              s,
+		started:        time.Now(),
+		inflight:       newInflightGauge(),
+		errorBreakdown: make(map[string]int),
+		statusCounts:   make(map[int]int),
+		errorSamples:   make(map[string]int),
+	}
+	if len(s.URLs) > 0 {
+		b.urlCounts = make(map[string]int)
+	}
+	if s.AggregateHeader != "" {
+		b.headerCounts = make(map[string]int)
+	}
+	if len(s.PathParams) > 0 {
+		b.distinctURLs = make(map[string]struct{})
+	}
+	b.errorWindow = newErrorWindow(b.started)
+	if c, ok := resumed[s.Name]; ok {
+		b.success, b.validationFail, b.requestFail = c.Success, c.ValidationFail, c.RequestFail
+		b.resumed = c.total()
+	}
+	return b
+}
+
+func (b *reportBuilder) add(result Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errorWindow.add(time.Now(), result.State != ResultOK)
+	if result.Pages > 0 {
+		b.pages += result.Pages
+		b.paged++
+	}
+	if b.urlCounts != nil {
+		if result.URLTemplate != "" {
+			b.urlCounts[result.URLTemplate]++
+		} else {
+			b.urlCounts[result.URL]++
+		}
+	}
+	if b.distinctURLs != nil {
+		b.distinctURLs[result.URL] = struct{}{}
+	}
+	if result.StatusCode != 0 {
+		b.statusCounts[result.StatusCode]++
+	}
+	if b.headerCounts != nil && result.HeaderValue != "" {
+		if _, ok := b.headerCounts[result.HeaderValue]; ok || len(b.headerCounts) < maxHeaderValues {
+			b.headerCounts[result.HeaderValue]++
+		} else {
+			b.headerOther++
+		}
+	}
+	if result.Revalidated {
+		b.revalidated++
+		if result.NotModified {
+			b.notModified++
+		}
+	}
+	if result.HasClockSkew {
+		b.clockSkewSum += result.ClockSkew
+		b.clockSkewSamples++
+	}
+	if result.Error != "" {
+		if _, ok := b.errorSamples[result.Error]; ok || len(b.errorSamples) < maxErrorSamples {
+			b.errorSamples[result.Error]++
+		}
+	}
+	if result.State != ResultRequestFail {
+		if timeseries != nil {
+			b.window = append(b.window, result.Latency)
+		}
+		if b.filtersLatency() {
+			b.unfilteredLatencies = append(b.unfilteredLatencies, result.Latency)
+			if b.includesLatency(result) {
+				b.latencies = append(b.latencies, result.Latency)
+				b.ttfbs = append(b.ttfbs, result.TTFB)
 			}
-			rlCh <- struct{}{}
+		} else {
+			b.latencies = append(b.latencies, result.Latency)
+			b.ttfbs = append(b.ttfbs, result.TTFB)
 		}
-	}()
+	}
+	switch result.State {
+	case ResultOK:
+		b.success++
+	case ResultValidationFail:
+		b.validationFail++
+	case ResultRequestFail:
+		b.requestFail++
+		if result.ErrorKind != "" {
+			b.errorBreakdown[result.ErrorKind]++
+		}
+		if result.ErrorKind == errKindHeaderTooLarge {
+			b.headerTooLarge++
+		}
+		if result.ErrorKind == errKindBodyRead {
+			b.bodyReadFail++
+		}
+	default:
+	}
+}
 
-	var count int
+// filtersLatency reports whether latency stats are computed only from
+// some responses
+func (b *reportBuilder) filtersLatency() bool {
+	return excludeStatusFromLatency || len(b.s.LatencyStatus) > 0
+}
+
+// includesLatency reports whether result is in filtered latency stats,
+// which is latency_status, or success by default
+func (b *reportBuilder) includesLatency(result Result) bool {
+	if len(b.s.LatencyStatus) == 0 {
+		return result.State == ResultOK
+	}
+	for _, code := range b.s.LatencyStatus {
+		if result.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// tick returns current counts and latencies since last tick
+func (b *reportBuilder) tick() (CheckpointCounts, []time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	window := b.window
+	b.window = nil
+	return CheckpointCounts{
+		Success:        b.success,
+		ValidationFail: b.validationFail,
+		RequestFail:    b.requestFail,
+	}, window
+}
+
+// abort records reason scenario was aborted
+func (b *reportBuilder) abort(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.abortReason = reason
+}
+
+// counts returns current result counts
+func (b *reportBuilder) counts() CheckpointCounts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return CheckpointCounts{
+		Success:        b.success,
+		ValidationFail: b.validationFail,
+		RequestFail:    b.requestFail,
+	}
+}
+
+func (b *reportBuilder) build() ScenarioReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report := ScenarioReport{
+		SuccessCount:        b.success,
+		ValidationFailCount: b.validationFail,
+		RequestFailCount:    b.requestFail,
+		HeaderTooLargeCount: b.headerTooLarge,
+		BodyReadFailCount:   b.bodyReadFail,
+		RevalidateCount:     b.revalidated,
+		NotModifiedCount:    b.notModified,
+		ErrorBreakdown:      b.errorBreakdown,
+		StatusCounts:        b.statusCounts,
+		AbortReason:         b.abortReason,
+		ErrorSamples:        b.errorSamples,
+		Latency:             NewLatencyStats(b.latencies),
+		TTFB:                NewLatencyStats(b.ttfbs),
+		URLCounts:           b.urlCounts,
+		HeaderCounts:        b.headerCounts,
+		DistinctURLs:        len(b.distinctURLs),
+		HeaderOtherCount:    b.headerOther,
+		AggregateHeader:     b.s.AggregateHeader,
+		Passed:              true,
+	}
+	if b.filtersLatency() {
+		unfiltered := NewLatencyStats(b.unfilteredLatencies)
+		report.UnfilteredLatency = &unfiltered
+	}
+	report.MaxInflight, report.AvgInflight = b.inflight.stats()
+	report.RequestedRPS = float64(b.s.rps())
+	report.Elapsed = time.Since(b.started)
+	if elapsed := report.Elapsed; elapsed > 0 {
+		total := b.success + b.validationFail + b.requestFail - b.resumed
+		report.AchievedRPS = float64(total) / elapsed.Seconds()
+	}
+	if b.clockSkewSamples > 0 {
+		report.AvgClockSkewMs = ms(b.clockSkewSum) / float64(b.clockSkewSamples)
+		report.ClockSkewSamples = b.clockSkewSamples
+	}
+	if b.s.Paginate != nil && b.paged > 0 {
+		report.AvgPages = float64(b.pages) / float64(b.paged)
+	}
+	report.ErrorRateWindow = b.s.Assert.errorRateWindow()
+	report.WorstWindowErrorRate, report.WorstWindowAt = b.errorWindow.worst(report.ErrorRateWindow)
+	if b.s.Assert != nil {
+		report.AssertResults = b.s.Assert.Evaluate(report)
+		report.AssertFailures = assertFailures(report.AssertResults)
+		report.Passed = len(report.AssertFailures) == 0
+	}
+	if report.AbortReason != "" {
+		report.Passed = false
+	}
+	return report
+}
+
+// requestCount returns total request count of scenario
+func requestCount(s Scenario) int {
 	if s.Period != nil {
-		count = int(math.Ceil(float64(*s.Period) * s.Throughput))
-	} else {
-		count = *s.Count
+		n := unboundedCount
+		if !s.rps().unlimited() {
+			n = int(math.Ceil(float64(*s.Period) * float64(s.rps())))
+		}
+		if s.Count != nil && *s.Count < n {
+			n = *s.Count
+		}
+		return n
 	}
+	return *s.Count
+}
 
-	done := make(chan struct{})
-	scenarioCh := make(chan Scenario, httpWorkerNum)
-	reportCh := make(chan ResultState)
+// nextRequest returns scenario of seq-th request, URL is selected when
+// urls is set and path params are substituted
+func nextRequest(s Scenario, r *rand.Rand, seq int) Scenario {
+	s.seq = seq
+	if len(s.URLs) > 0 {
+		s.URL = pickURL(r, s.URLs)
+	}
+	if len(s.urlList) > 0 {
+		s.URL = s.urlList[seq%len(s.urlList)]
+	}
+	if len(s.PathParams) > 0 {
+		s.urlTemplate = s.URL
+		s.URL = expandPathParams(s.URL, s.PathParams, seq)
+	}
+	return s
+}
+
+// generatorContext returns context cancelled by ctx or drain
+func generatorContext(ctx context.Context, drain <-chan struct{}) (context.Context, context.CancelFunc) {
+	genCtx, stop := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-drain:
+			stop()
+		case <-genCtx.Done():
+		}
+	}()
+	return genCtx, stop
+}
+
+// startWorkers starts http workers. Returned channel is closed after
+// scenarioCh is closed and all workers finished
+func startWorkers(ctx context.Context, scenarioCh <-chan Scenario, workers int) <-chan Result {
+	reportCh := make(chan Result)
 
-	for i := 0; i < httpWorkerNum; i++ {
-		go scenarioWorker(ctx, scenarioCh, done, reportCh)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		id := int(atomic.AddInt64(&workerSeq, 1))
+		go func() {
+			defer wg.Done()
+			scenarioWorker(ctx, id, scenarioCh, reportCh)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(reportCh)
+	}()
+	return reportCh
+}
+
+// ScenarioRun runs scenario with context.
+// Cancelling ctx stops scenario immediately, closing drain stops issuing
+// new requests and waits outstanding requests.
+func ScenarioRun(ctx context.Context, drain <-chan struct{}, s Scenario) ScenarioReport {
+	rl := rate.NewLimiter(s.rps().limit(), 1)
+
+	genCtx, stop := generatorContext(ctx, drain)
+	defer stop()
+	// ramp down sends less than period * throughput, and unlimited
+	// throughput has no count, period bounds them
+	if s.RampDown != nil || (s.Period != nil && s.rps().unlimited()) {
+		var cancel context.CancelFunc
+		genCtx, cancel = context.WithTimeout(genCtx, time.Duration(*s.Period)*time.Second)
+		defer cancel()
+	}
+	if s.RampDown != nil {
+		go rampDown(genCtx, rl, s)
 	}
 
+	count := requestCount(s)
+
+	r := scenarioRand(s.Name)
+
+	b := newReportBuilder(s)
+	live.register(b)
+	s.inflight = b.inflight
+
+	scenarioCh := make(chan Scenario, httpWorkerNum)
+	reportCh := startWorkers(ctx, scenarioCh, s.workers())
+
 	go func() {
-		defer close(reportCh)
-		var c int
-		for i := 1; i <= count; i++ {
-			select {
-			case <-ctx.Done():
+		defer close(scenarioCh)
+		if s.RandomOffset {
+			if err := sleepOffset(genCtx, r, s.rps()); err != nil {
 				return
-			case _, ok := <-rlCh:
-				if !ok {
-					return
-				}
-				c++
-				scenarioCh <- s
 			}
 		}
+		start := time.Now()
+		for i := 1; i <= count || time.Since(start) < minDuration; i++ {
+			if err := rl.Wait(genCtx); err != nil {
+				return
+			}
+			scenarioCh <- nextRequest(s, r, i-1)
+		}
+	}()
+
+	var guard *latencyGuard
+	var guardTick <-chan time.Time
+	if s.LatencyAbort != nil {
+		guard = newLatencyGuard(*s.LatencyAbort)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		guardTick = ticker.C
+	}
+	for {
+		select {
+		case result, ok := <-reportCh:
+			if !ok {
+				report := b.build()
+				report.Cancelled = ctx.Err() != nil
+				return report
+			}
+			b.add(result)
+			if guard != nil && result.State != ResultRequestFail {
+				guard.add(time.Now(), result.Latency)
+			}
+		case now := <-guardTick:
+			if reason, abort := guard.check(now); abort {
+				log.Printf("[%s] Abort: %s", s.Name, reason)
+				b.abort(reason)
+				// stop issuing new requests, outstanding requests finish
+				stop()
+				guardTick = nil
+			}
+		}
+	}
+}
 
-		for i := 0; i < c; i++ {
-			<-done
+// sleepOffset sleeps random phase within one request interval of
+// throughput, drawn from scenario random stream
+func sleepOffset(ctx context.Context, r *rand.Rand, t Throughput) error {
+	if t.unlimited() {
+		return nil
+	}
+	offset := time.Duration(r.Float64() * float64(time.Second) / float64(t))
+	timer := time.NewTimer(offset)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rampDown decreases limit of rl linearly over ramp_down window at the end
+// of period, until ctx is done
+func rampDown(ctx context.Context, rl *rate.Limiter, s Scenario) {
+	window := *s.RampDown
+	end := time.Now().Add(time.Duration(*s.Period) * time.Second)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(end.Add(-window))):
+	}
+
+	// keep small rate so Wait does not block forever before period ends
+	throughput := float64(s.rps())
+	floor := throughput / 100
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		limit := throughput * float64(time.Until(end)) / float64(window)
+		if limit < floor {
+			limit = floor
+		}
+		rl.SetLimit(rate.Limit(limit))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validateMixed checks scenarios can run with -mixed. Settings which
+// need own rate or workers of scenario are rejected instead of ignored
+func validateMixed(scenarios []Scenario) error {
+	for _, s := range scenarios {
+		// mixed rate is sum of scenario throughputs
+		if s.rps().unlimited() {
+			return xerrors.Errorf("scenario %s: unlimited throughput cannot be used with -mixed", s.Name)
+		}
+		// single stream has no per scenario rate to lower or abort
+		if s.LatencyAbort != nil {
+			return xerrors.Errorf("scenario %s: latency_abort cannot be used with -mixed", s.Name)
+		}
+		if s.RampDown != nil {
+			return xerrors.Errorf("scenario %s: ramp_down cannot be used with -mixed", s.Name)
+		}
+		// requests are picked from shared stream, which has no per
+		// scenario start to offset
+		if s.RandomOffset {
+			return xerrors.Errorf("scenario %s: random_offset cannot be used with -mixed", s.Name)
+		}
+		// workers are shared by all scenarios
+		if s.Serial {
+			return xerrors.Errorf("scenario %s: serial cannot be used with -mixed", s.Name)
+		}
+	}
+	return nil
+}
+
+// MixedRun runs scenarios as single request stream. Throughput is sum of
+// scenario throughputs and each request picks scenario by weight.
+func MixedRun(ctx context.Context, drain <-chan struct{}, scenarios []Scenario) map[string]ScenarioReport {
+	var throughput float64
+	var count int
+	weights := make([]float64, len(scenarios))
+	builders := make(map[string]*reportBuilder)
+	rands := make([]*rand.Rand, len(scenarios))
+	seqs := make([]int, len(scenarios))
+	// copy, gauges are set to scenarios of this run
+	scenarios = append([]Scenario(nil), scenarios...)
+	for i, s := range scenarios {
+		rands[i] = scenarioRand(s.Name)
+		throughput += float64(s.rps())
+		count += requestCount(s)
+		weights[i] = float64(s.rps())
+		if s.Weight != nil {
+			weights[i] = *s.Weight
+		}
+		builders[s.Name] = newReportBuilder(s)
+		live.register(builders[s.Name])
+		scenarios[i].inflight = builders[s.Name].inflight
+	}
+	rl := rate.NewLimiter(rate.Limit(throughput), 1)
+
+	genCtx, stop := generatorContext(ctx, drain)
+	defer stop()
+
+	scenarioCh := make(chan Scenario, httpWorkerNum)
+	reportCh := startWorkers(ctx, scenarioCh, httpWorkerNum)
+
+	go func() {
+		defer close(scenarioCh)
+		start := time.Now()
+		for n := 1; n <= count || time.Since(start) < minDuration; n++ {
+			if err := rl.Wait(genCtx); err != nil {
+				return
+			}
+			i := pickWeighted(rng, weights)
+			scenarioCh <- nextRequest(scenarios[i], rands[i], seqs[i])
+			seqs[i]++
 		}
 	}()
 
-	var success, validationFail, requestFail int
-	for state := range reportCh {
-		switch state {
-		case ResultOK:
-			success++
-		case ResultValidationFail:
-			validationFail++
-		case ResultRequestFail:
-			requestFail++
-		default:
+	for result := range reportCh {
+		builders[result.Name].add(result)
+	}
+	reports := make(map[string]ScenarioReport)
+	for name, b := range builders {
+		report := b.build()
+		report.Cancelled = ctx.Err() != nil
+		reports[name] = report
+	}
+	return reports
+}
+
+// closeOutputs flushes and closes outputs written during run
+func closeOutputs() {
+	if resultStream != nil {
+		if err := resultStream.Close(); err != nil {
+			resultLog.Printf("Error: %s", err)
 		}
 	}
-	return ScenarioReport{
-		SuccessCount:        success,
-		ValidationFailCount: validationFail,
-		RequestFailCount:    requestFail,
+	if events != nil {
+		if dropped := events.Close(); dropped > 0 {
+			resultLog.Printf("nats: %d events dropped", dropped)
+		}
+	}
+	if timeseries != nil {
+		if err := timeseries.Close(); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+	}
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+	}
+}
+
+// writeReportFile writes output by write to path, or stdout when path is empty
+func writeReportFile(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
 	}
+	return f.Close()
 }
 
 func main() {
 	scenarioFileName := flag.String("f", "scenario.yml", "scenario file")
+	urlsFile := flag.String("urls-file", "", "send GET to each URL in file (one per line, # comments) instead of -f scenarios")
+	urlsThroughput := flag.Float64("urls-throughput", 1, "throughput of -urls-file, 0 means unlimited")
+	urlsRepeat := flag.Int("urls-repeat", 1, "times -urls-file list is sent round-robin")
 	flag.IntVar(&httpWorkerNum, "c", 100, "http request concurrency per scenario")
+	flag.IntVar(&maxConnsPerHost, "max-conns-per-host", 0, "max connections (active + idle) per host, 0 means unlimited")
+	flag.Int64Var(&maxResponseHeaderBytes, "max-response-header-bytes", 0, "max response header size, 0 means Go default (1MB)")
+	logDest := flag.String("log", "stderr", "request log destination: stderr or stdout")
+	logRate := flag.Int("log-rate", 0, "max request log lines per second, excess lines are dropped with periodic summary, 0 means unlimited")
+	logFileName := flag.String("log-file", "", "write request logs to file instead of -log destination")
+	flag.Int64Var(&seed, "seed", 0, "random seed, 0 means seed from current time")
+	flag.BoolVar(&seedPerScenario, "seed-per-scenario", false, "give each scenario independent random stream derived from -seed and scenario name")
+	shardFlag := flag.String("shard", "", "run only slice i of N of configured load, e.g. 1/3")
+	mixed := flag.Bool("mixed", false, "run all scenarios as single request stream picking scenario by weight")
+	selftest := flag.Bool("selftest", false, "run built-in scenario against in-process server to measure max rps and overhead of splay, and exit")
+	selftestLatency := flag.Duration("selftest-latency", 0, "artificial latency of -selftest server")
+	selftestDuration := flag.Duration("selftest-duration", 5*time.Second, "how long -selftest runs")
+	maxWallclock := flag.Duration("max-wallclock", 0, "cancel run after this time and fail when any scenario did not finish, 0 is no limit")
+	verbose := flag.Bool("verbose", false, "print connection pool stats per host (dials, peak open, closed) in result")
+	failFastOnConnect := flag.Bool("fail-fast-on-connect", false, "abort run on first connection error (DNS failure, refused, etc.), not on error responses")
+	serialScenarios := flag.Bool("serial-scenarios", false, "run scenarios one after another in file order instead of concurrently")
+	monitor := flag.Bool("monitor", false, "run each scenario once per -interval until interrupted")
+	interval := flag.Duration("interval", time.Minute, "interval of -monitor")
+	traceFile := flag.String("trace-file", "", "write request timeline as Chrome trace event JSON")
+	traceSample := flag.Float64("trace-sample", 1, "ratio of requests recorded by -trace-file (0, 1]")
+	timeseriesFile := flag.String("timeseries-file", "", "write per-second RPS, errors and p95 per scenario, CSV when file ends with .csv, JSON lines otherwise")
+	checkpointFile := flag.String("checkpoint-file", "", "write in-progress result counts to file periodically")
+	preview := flag.Int("preview", 0, "print first N requests of each scenario as they would be sent, and exit without sending")
+	dumpConfigFlag := flag.Bool("dump-config", false, "print effective flags, transport settings and scenarios with secrets redacted, and exit")
+	resume := flag.Bool("resume", false, "continue toward request count from counts in -checkpoint-file")
+	checkpointInterval := flag.Duration("checkpoint-interval", 10*time.Second, "interval of -checkpoint-file")
+	flag.BoolVar(&reuseRequests, "reuse-requests", false, "clone cached request per send instead of parsing it again")
+	flag.DurationVar(&minDuration, "min-duration", 0, "keep issuing requests until scenario ran at least this long, even after count")
+	flag.BoolVar(&excludeStatusFromLatency, "exclude-status-from-latency", false, "compute latency stats only from successful responses, or latency_status of scenario")
+	flag.BoolVar(&measureClockSkew, "clock-skew", false, "report average difference between server Date header and local time")
+	output := flag.String("o", "text", "output format: text, junit, or jsonl streaming each result (text summary is always printed), or json with -preview")
+	reportFile := flag.String("report-file", "", "file to write -o output to, stdout when empty")
+	assertNo5xx := flag.Bool("assert-no-5xx", false, "exit with status 1 when any response had 5xx status")
+	healthCheckURL := flag.String("healthcheck-url", "", "URL probed once before load, run is aborted when it fails")
+	natsURL := flag.String("nats-url", "", "publish each request result as JSON to NATS (e.g. nats://localhost:4222)")
+	natsSubject := flag.String("nats-subject", "splay.results", "NATS subject of -nats-url")
+	influxFile := flag.String("influx-file", "", "write result in InfluxDB line protocol to file")
+	influxURL := flag.String("influx-url", "", "push result in InfluxDB line protocol to InfluxDB (e.g. http://localhost:8086)")
+	influxDB := flag.String("influx-db", "splay", "database name used with -influx-url")
+	waitForReady := flag.String("wait-for-ready", "", "poll URL with backoff until it returns 2xx before load, run is aborted after -wait-timeout")
+	waitTimeout := flag.Duration("wait-timeout", time.Minute, "how long -wait-for-ready waits")
+	healthCheckStatus := flag.Int("healthcheck-status", 0, "expected status code of -healthcheck-url, 0 means any 2xx")
 	flag.Parse()
 
-	f, err := os.Open(*scenarioFileName)
-	if err != nil {
-		log.Fatal(err)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
+	rng.Seed(seed)
 
-	scenario, err := LoadScenarioFile(f)
-	_ = f.Close()
-	if err != nil {
-		log.Fatal(err)
+	var logFile *reopenFile
+	var logWriter io.Writer
+	if *logFileName != "" {
+		f, err := openLogFile(*logFileName)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		defer f.Close()
+		logFile = f
+		logWriter = f
+	} else {
+		w, err := logOutput(*logDest)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		logWriter = w
+	}
+	var throttle *throttledWriter
+	if *logRate > 0 {
+		throttle = newThrottledWriter(logWriter, *logRate)
+		logWriter = throttle
+	}
+	log.SetOutput(logWriter)
+
+	http.DefaultTransport.(*http.Transport).MaxConnsPerHost = maxConnsPerHost
+	http.DefaultTransport.(*http.Transport).MaxResponseHeaderBytes = maxResponseHeaderBytes
+	if *verbose {
+		pool = newPoolStats()
+		pool.instrument(http.DefaultTransport.(*http.Transport))
+	}
+
+	if *selftest {
+		err := runSelftest(*selftestLatency, *selftestDuration)
+		if pool != nil {
+			pool.print()
+		}
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		return
+	}
+
+	var scenario *ScenarioData
+	if *urlsFile != "" {
+		// -urls-file bypasses scenario file
+		f, err := os.Open(*urlsFile)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		urls, err := readURLsFile(f)
+		_ = f.Close()
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		if *urlsRepeat < 1 {
+			resultLog.Fatalf("-urls-repeat must be positive: %d", *urlsRepeat)
+		}
+		s := newURLsFileScenario(urls, Throughput(*urlsThroughput), *urlsRepeat)
+		if err := validateScenario(s); err != nil {
+			resultLog.Fatal(err)
+		}
+		scenario = &ScenarioData{Scenarios: []Scenario{s}}
+	} else {
+		f, err := os.Open(*scenarioFileName)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		scenario, err = LoadScenarioFile(f)
+		_ = f.Close()
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+	}
+
+	// setup and teardown are sent once in every shard, they are not split
+	setup, configured, teardown := splitPhases(scenario.Scenarios)
+	scenarios := configured
+	if pool != nil {
+		instrumented := make(map[*namedTransport]bool)
+		for _, s := range scenario.Scenarios {
+			if s.transport != nil && !instrumented[s.transport] {
+				pool.instrument(s.transport.transport)
+				instrumented[s.transport] = true
+			}
+		}
+	}
+	shardName := ""
+	if *shardFlag != "" {
+		sh, err := parseShard(*shardFlag)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		shardName = sh.String()
+		scenarios = make([]Scenario, len(configured))
+		for i, s := range configured {
+			scenarios[i] = sh.apply(s)
+		}
+	}
+	if *resume {
+		if *checkpointFile == "" {
+			resultLog.Fatal("-resume requires -checkpoint-file")
+		}
+		c, err := readCheckpoint(*checkpointFile)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		resumed = c.Scenarios
+		resumedScenarios := make([]Scenario, len(scenarios))
+		for i, s := range scenarios {
+			resumedScenarios[i] = resumeScenario(s, c.Scenarios[s.Name])
+			resultLog.Printf("resume|[%s]\tcompleted: %d, remaining: %d", s.Name, c.Scenarios[s.Name].total(), *resumedScenarios[i].Count)
+		}
+		scenarios = resumedScenarios
+	}
+
+	if *dumpConfigFlag {
+		if err := dumpConfig(os.Stdout, withHooks(setup, scenarios, teardown)); err != nil {
+			resultLog.Fatal(err)
+		}
+		return
+	}
+	if *preview > 0 {
+		if err := previewScenarios(os.Stdout, withHooks(setup, scenarios, teardown), *preview, *output == "json" || *output == "jsonl"); err != nil {
+			resultLog.Fatal(err)
+		}
+		return
+	}
+
+	// flag combinations are checked before any output file is created, so
+	// that a rejected run does not truncate files of previous run
+	switch *output {
+	case "text":
+	case "junit", "jsonl":
+		if *reportFile == "" && *logFileName == "" && *logDest == "stdout" {
+			resultLog.Fatalf("-o %s to stdout cannot be used with -log stdout", *output)
+		}
+	default:
+		resultLog.Fatalf("unknown output format: %s", *output)
+	}
+	if *mixed && *serialScenarios {
+		resultLog.Fatal("-mixed cannot be used with -serial-scenarios")
+	}
+	if *mixed {
+		if err := validateMixed(scenarios); err != nil {
+			resultLog.Fatal(err)
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// -max-wallclock cancels requests in flight, the same as SIGINT. It is
+	// timer instead of context deadline, because rate limiter stops
+	// waiting early when next request would be after deadline
+	wallclockDeadline := time.Now().Add(*maxWallclock)
+	if *maxWallclock > 0 {
+		t := time.AfterFunc(*maxWallclock, cancel)
+		defer t.Stop()
+	}
+	if *failFastOnConnect {
+		connectFail = &failFast{cancel: cancel}
+	}
 
+	// SIGINT cancels all requests and second SIGINT exits immediately,
+	// SIGHUP stops issuing new requests and waits for outstanding
+	// requests. SIGUSR1 reopens log file.
+	drain := make(chan struct{})
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signals := []os.Signal{os.Interrupt, syscall.SIGHUP}
+	if reopenSignal != nil {
+		signals = append(signals, reopenSignal)
+	}
+	signal.Notify(c, signals...)
 	go func() {
-		sig := <-c
-		switch {
-		case sig == os.Interrupt:
-			fmt.Println("stop")
-			cancel()
-		default:
-			log.Println("Unknown")
+		draining, stopping := false, false
+		for sig := range c {
+			switch {
+			case sig == os.Interrupt && stopping:
+				resultLog.Println("force quit")
+				// 128 + SIGINT, as shells report process killed by it
+				os.Exit(130)
+			case sig == os.Interrupt:
+				resultLog.Println("stop (press Ctrl-C again to force quit)")
+				stopping = true
+				cancel()
+			case sig == syscall.SIGHUP:
+				if draining {
+					continue
+				}
+				resultLog.Println("drain")
+				draining = true
+				close(drain)
+			case sig == reopenSignal:
+				if logFile == nil {
+					continue
+				}
+				if err := logFile.Reopen(); err != nil {
+					resultLog.Printf("Error: %s", err)
+				}
+			default:
+				log.Println("Unknown")
+			}
 		}
-
 	}()
 
+	var healthChecks []HealthCheck
+	if *healthCheckURL != "" {
+		healthChecks = append(healthChecks, HealthCheck{URL: *healthCheckURL, Status: *healthCheckStatus})
+	}
+	for _, s := range scenario.Scenarios {
+		if s.HealthCheck != nil {
+			healthChecks = append(healthChecks, *s.HealthCheck)
+		}
+	}
+	if *waitForReady != "" {
+		if err := (HealthCheck{URL: *waitForReady}).WaitReady(ctx, *waitTimeout); err != nil {
+			resultLog.Fatalf("abort: %s", err)
+		}
+	}
+	for _, h := range healthChecks {
+		if err := h.Probe(ctx); err != nil {
+			resultLog.Fatalf("abort: %s", err)
+		}
+	}
+
+	// runSetup sends setup, and when it fails sends teardown to clean up
+	// what setup did and exits. Nothing may exit between setup and
+	// teardown without it
+	runSetup := func() []Result {
+		results, ok := runHooks(ctx, setup, true)
+		if ok {
+			return results
+		}
+		printHooks(phaseSetup, setup, results)
+		teardownResults, _ := runHooks(context.Background(), teardown, false)
+		printHooks(phaseTeardown, teardown, teardownResults)
+		closeOutputs()
+		resultLog.Fatal("abort: setup failed")
+		return nil
+	}
+
+	if *monitor {
+		runSetup()
+		runMonitor(ctx, drain, configured, *interval)
+		teardownResults, _ := runHooks(context.Background(), teardown, false)
+		printHooks(phaseTeardown, teardown, teardownResults)
+		return
+	}
+
+	if *traceFile != "" {
+		t, err := newTraceWriter(*traceFile, *traceSample)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		tracer = t
+	}
+
+	if *output == "jsonl" {
+		w, err := newJSONLWriter(*reportFile, shardName)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		resultStream = w
+	}
+
+	if *natsURL != "" {
+		p, err := newNATSPublisher(*natsURL, *natsSubject, shardName)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		events = p
+	}
+	if *timeseriesFile != "" {
+		t, err := startTimeseries(*timeseriesFile)
+		if err != nil {
+			resultLog.Fatal(err)
+		}
+		timeseries = t
+	}
+
+	// manifest keeps scenarios as configured, -shard is in its flags
+	manifest := NewManifest(scenario.Scenarios)
+	manifest.StartedAt = time.Now()
+	manifest.Shard = shardName
+
+	// outputs are ready, setup is sent after every check which can fail
+	setupResults := runSetup()
+
+	if *checkpointFile != "" {
+		go runCheckpoint(ctx, *checkpointFile, *checkpointInterval)
+	}
+
 	wg := sync.WaitGroup{}
 	mutex := sync.Mutex{}
 	reports := make(map[string]ScenarioReport)
-	for _, s := range scenario.Scenarios {
+	if *mixed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports = MixedRun(ctx, drain, scenarios)
+		}()
+	} else if *serialScenarios {
 		wg.Add(1)
-		go func(s Scenario) {
+		go func() {
 			defer wg.Done()
-			defer mutex.Unlock()
+			for _, s := range scenarios {
+				// after interrupt, scenarios not started yet are skipped
+				select {
+				case <-drain:
+					return
+				default:
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				reports[s.Name] = ScenarioRun(ctx, drain, s)
+			}
+		}()
+	} else {
+		for _, s := range scenarios {
+			wg.Add(1)
+			go func(s Scenario) {
+				defer wg.Done()
+				defer mutex.Unlock()
 
-			report := ScenarioRun(ctx, s)
-			mutex.Lock()
-			reports[s.Name] = report
-		}(s)
+				report := ScenarioRun(ctx, drain, s)
+				mutex.Lock()
+				reports[s.Name] = report
+			}(s)
+		}
 	}
 
 	log.Println("Running")
 	wg.Wait()
-	log.Println("--------------------Result--------------------")
+	manifest.FinishedAt = time.Now()
+	// teardown runs after interrupt or -max-wallclock too, so it has own
+	// context
+	teardownResults, teardownOK := runHooks(context.Background(), teardown, false)
+	if *checkpointFile != "" {
+		// interrupted or drained run keeps last checkpoint as unfinished
+		drained := false
+		select {
+		case <-drain:
+			drained = true
+		default:
+		}
+		finished := ctx.Err() == nil && !drained && reachedTargets(scenarios, reports, *mixed)
+		if err := writeCheckpoint(*checkpointFile, finished); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+	}
+	if throttle != nil {
+		throttle.Close()
+	}
+	closeOutputs()
+
+	printManifest(manifest)
+	resultLog.Println("--------------------Result--------------------")
 
+	passed := teardownOK
+	printHooks(phaseSetup, setup, setupResults)
 	for name, report := range reports {
 		var (
 			success        = report.SuccessCount
 			validationFail = report.ValidationFailCount
 			requestFail    = report.RequestFailCount
+			latency        = report.Latency
 		)
-		log.Printf("finished|[%s]\tsuccess: %d, validation fail: %d, request fail: %d",
+		resultLog.Printf("finished|[%s]\tsuccess: %d, validation fail: %d, request fail: %d",
 			name, success, validationFail, requestFail)
+		resultLog.Printf("throughput|[%s]\trequested: %s, achieved: %.2f rps",
+			name, Throughput(report.RequestedRPS), report.AchievedRPS)
+		resultLog.Printf("inflight|[%s]\tmax: %d, avg: %.2f", name, report.MaxInflight, report.AvgInflight)
+		if report.HeaderTooLargeCount > 0 {
+			resultLog.Printf("finished|[%s]\tresponse header too large: %d (included in request fail)",
+				name, report.HeaderTooLargeCount)
+		}
+		if report.RevalidateCount > 0 {
+			resultLog.Printf("etag|[%s]\trevalidated: %d, not modified: %d (%.1f%%)",
+				name, report.RevalidateCount, report.NotModifiedCount,
+				float64(report.NotModifiedCount)/float64(report.RevalidateCount)*100)
+		}
+		if report.BodyReadFailCount > 0 {
+			resultLog.Printf("finished|[%s]\tbody read fail: %d (included in request fail)",
+				name, report.BodyReadFailCount)
+		}
+		if len(report.StatusCounts) > 0 {
+			resultLog.Printf("status|[%s]\t%s", name, formatStatusCounts(report.StatusCounts))
+		}
+		if validationFail+requestFail > 0 {
+			resultLog.Printf("errors|[%s]\tworst %v window: %.2f%% at %v",
+				name, report.ErrorRateWindow, report.WorstWindowErrorRate*100, report.WorstWindowAt)
+		}
+		for _, kind := range sortedKeys(report.ErrorBreakdown) {
+			resultLog.Printf("errors|[%s]\t%s: %d", name, kind, report.ErrorBreakdown[kind])
+		}
+		resultLog.Printf("latency|[%s]\tp50: %v, p95: %v, p99: %v, max: %v, mean: %v, stddev: %v, cv: %.3f",
+			name, latency.P50, latency.P95, latency.P99, latency.Max, latency.Mean, latency.StdDev, latency.CV())
+		resultLog.Printf("ttfb|[%s]\tp50: %v, p95: %v, p99: %v, max: %v",
+			name, report.TTFB.P50, report.TTFB.P95, report.TTFB.P99, report.TTFB.Max)
+		if all := report.UnfilteredLatency; all != nil {
+			resultLog.Printf("latency|[%s]\tunfiltered p50: %v, p95: %v, p99: %v, max: %v",
+				name, all.P50, all.P95, all.P99, all.Max)
+		}
+		if report.ClockSkewSamples > 0 {
+			resultLog.Printf("clock skew|[%s]\tavg: %.1fms (%d responses)", name, report.AvgClockSkewMs, report.ClockSkewSamples)
+		}
+		if report.AvgPages > 0 {
+			resultLog.Printf("pages|[%s]\tavg: %.2f", name, report.AvgPages)
+		}
+		if report.DistinctURLs > 0 {
+			resultLog.Printf("urls|[%s]\tdistinct: %d", name, report.DistinctURLs)
+		}
+		for _, u := range sortedKeys(report.URLCounts) {
+			resultLog.Printf("urls|[%s]\t%s: %d", name, u, report.URLCounts[u])
+		}
+		for _, v := range sortedKeys(report.HeaderCounts) {
+			resultLog.Printf("header|[%s]\t%s: %s: %d", name, report.AggregateHeader, v, report.HeaderCounts[v])
+		}
+		if report.HeaderOtherCount > 0 {
+			resultLog.Printf("header|[%s]\twarning: %d responses not tracked, over %d distinct values", name, report.HeaderOtherCount, maxHeaderValues)
+		}
+		if report.AbortReason != "" {
+			resultLog.Printf("abort|[%s]\t%s", name, report.AbortReason)
+		}
+		for _, failure := range report.AssertFailures {
+			resultLog.Printf("assert|[%s]\t%s", name, failure)
+		}
+		if report.Passed {
+			resultLog.Printf("verdict|[%s]\tPASS", name)
+		} else {
+			resultLog.Printf("verdict|[%s]\tFAIL", name)
+			passed = false
+		}
+	}
+	printHooks(phaseTeardown, teardown, teardownResults)
+	if pool != nil {
+		pool.print()
+	}
+	if connectFail != nil {
+		if err := connectFail.Err(); err != nil {
+			resultLog.Printf("abort|\tconnection failed: %s", err)
+			passed = false
+		}
+	}
+	if *maxWallclock > 0 && ctx.Err() != nil && !time.Now().Before(wallclockDeadline) {
+		resultLog.Printf("wallclock|\tstopped after -max-wallclock %v", *maxWallclock)
+		for _, s := range scenarios {
+			report, ok := reports[s.Name]
+			if !ok {
+				// not started, with -serial-scenarios
+				report.Cancelled = true
+			}
+			if !report.Cancelled {
+				continue
+			}
+			passed = false
+			completed := report.SuccessCount + report.ValidationFailCount + report.RequestFailCount
+			if target := requestCount(s); target != unboundedCount {
+				target += resumed[s.Name].total()
+				resultLog.Printf("wallclock|[%s]\tcut short: completed %d of %d requests (%d remaining)",
+					s.Name, completed, target, target-completed)
+			} else {
+				period := time.Duration(*s.Period) * time.Second
+				resultLog.Printf("wallclock|[%s]\tcut short: ran %v of period %v (%v remaining)",
+					s.Name, report.Elapsed.Round(time.Millisecond), period, (period - report.Elapsed).Round(time.Millisecond))
+			}
+		}
+	}
+	if *assertNo5xx {
+		for name, report := range reports {
+			if n := count5xx(report.StatusCounts); n > 0 {
+				resultLog.Printf("assert|[%s]\t5xx: expected: 0, got: %d", name, n)
+				passed = false
+			}
+		}
+	}
+
+	if *output == "junit" {
+		if err := writeReportFile(*reportFile, func(w io.Writer) error {
+			return writeJUnit(w, reports, manifest.FinishedAt.Sub(manifest.StartedAt), *assertNo5xx)
+		}); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+	}
+
+	if *influxFile != "" || *influxURL != "" {
+		buf := bytes.Buffer{}
+		if err := writeInflux(&buf, reports, manifest.FinishedAt); err != nil {
+			resultLog.Printf("Error: %s", err)
+		}
+		if *influxFile != "" {
+			if err := ioutil.WriteFile(*influxFile, buf.Bytes(), 0644); err != nil {
+				resultLog.Printf("Error: %s", err)
+			}
+		}
+		if *influxURL != "" {
+			if err := pushInflux(*influxURL, *influxDB, buf.Bytes()); err != nil {
+				resultLog.Printf("Error: %s", err)
+			}
+		}
+	}
+
+	if !passed {
+		cancel()
+		os.Exit(1)
 	}
 }
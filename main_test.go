@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// request logs of every request are noise in test output
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// loadScenario loads scenario file of one scenario
+func loadScenario(t *testing.T, file string) Scenario {
+	t.Helper()
+	data, err := LoadScenarioFile(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Scenarios) != 1 {
+		t.Fatalf("scenarios: expected: 1, got: %d", len(data.Scenarios))
+	}
+	return data.Scenarios[0]
+}
+
+// runScenario runs s with timeout, so that a scenario which never
+// finishes fails the test instead of hanging it
+func runScenario(t *testing.T, s Scenario) ScenarioReport {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report := ScenarioRun(ctx, nil, s)
+	if ctx.Err() != nil {
+		t.Fatalf("scenario %s did not finish: %v", s.Name, ctx.Err())
+	}
+	return report
+}
+
+func TestBodyReadFail(t *testing.T) {
+	// server sends header and part of body, then closes connection
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\npartial")
+		_ = buf.Flush()
+	}))
+	defer srv.Close()
+
+	s := loadScenario(t, fmt.Sprintf(`
+scenarios:
+  - name: mid-body
+    url: %s
+    throughput: 10
+    count: 3
+`, srv.URL))
+	report := runScenario(t, s)
+	if report.RequestFailCount != 3 {
+		t.Errorf("request fail: expected: 3, got: %d", report.RequestFailCount)
+	}
+	if report.BodyReadFailCount != 3 {
+		t.Errorf("body read fail: expected: 3, got: %d", report.BodyReadFailCount)
+	}
+	if n := report.ErrorBreakdown[errKindBodyRead]; n != 3 {
+		t.Errorf("%s: expected: 3, got: %d, breakdown: %v", errKindBodyRead, n, report.ErrorBreakdown)
+	}
+}
+
+// largeScenarioFile generates scenario file of n scenarios
+func largeScenarioFile(n int) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString("scenarios:\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "  - name: scenario-%d\n", i)
+		fmt.Fprintf(&buf, "    url: http://127.0.0.1/items/%d\n", i)
+		buf.WriteString("    throughput: 10\n")
+		buf.WriteString("    count: 100\n")
+		buf.WriteString("    validates:\n")
+		buf.WriteString("    - name: status_code=200\n")
+		buf.WriteString("      status_code: 200\n")
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkStreamScenarioFile(b *testing.B) {
+	file := largeScenarioFile(10000)
+	b.SetBytes(int64(len(file)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		err := StreamScenarioFile(bytes.NewReader(file), func(Scenario) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != 10000 {
+			b.Fatalf("scenarios: expected: 10000, got: %d", n)
+		}
+	}
+}
+
+func BenchmarkNewRequest(b *testing.B) {
+	s := Scenario{
+		Name: "bench",
+		URL:  "http://127.0.0.1/items?page=1&per_page=100",
+		Headers: map[string]string{
+			"Accept":        "application/json",
+			"Authorization": "Bearer token",
+			"User-Agent":    "splay",
+		},
+	}
+	defer func(reuse bool) { reuseRequests = reuse }(reuseRequests)
+	for _, reuse := range []bool{false, true} {
+		name := "build"
+		if reuse {
+			name = "reuse"
+		}
+		b.Run(name, func(b *testing.B) {
+			reuseRequests = reuse
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := newRequest(s, s.URL); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnlimitedThroughput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, throughput := range []string{"0", "unlimited"} {
+		t.Run(throughput, func(t *testing.T) {
+			s := loadScenario(t, fmt.Sprintf(`
+scenarios:
+  - name: unlimited-%s
+    url: %s
+    throughput: %s
+    count: 20
+`, throughput, srv.URL, throughput))
+			if !s.rps().unlimited() {
+				t.Fatalf("throughput %s is not unlimited: %v", throughput, s.rps())
+			}
+			report := runScenario(t, s)
+			if report.SuccessCount != 20 {
+				t.Errorf("success: expected: 20, got: %d", report.SuccessCount)
+			}
+		})
+	}
+}
+
+func TestThroughputRequired(t *testing.T) {
+	_, err := LoadScenarioFile(strings.NewReader(`
+scenarios:
+  - name: no throughput
+    url: http://127.0.0.1/
+    count: 1
+`))
+	if err == nil || !strings.Contains(err.Error(), "throughput is required") {
+		t.Errorf("expected throughput is required error, got: %v", err)
+	}
+}
+
+func TestSerial(t *testing.T) {
+	var inflight, peak int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inflight, 1)
+		defer atomic.AddInt64(&inflight, -1)
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		// overlap would be seen while request is held
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	s := loadScenario(t, fmt.Sprintf(`
+scenarios:
+  - name: serial
+    url: %s
+    throughput: unlimited
+    count: 20
+    serial: true
+`, srv.URL))
+	report := runScenario(t, s)
+	if report.SuccessCount != 20 {
+		t.Errorf("success: expected: 20, got: %d", report.SuccessCount)
+	}
+	if p := atomic.LoadInt64(&peak); p != 1 {
+		t.Errorf("max in-flight on server: expected: 1, got: %d", p)
+	}
+}
+
+func TestValidateMixed(t *testing.T) {
+	// -mixed shares one stream and its workers, these settings would be
+	// ignored there
+	for _, field := range []string{"serial", "random_offset"} {
+		t.Run(field, func(t *testing.T) {
+			s := loadScenario(t, fmt.Sprintf(`
+scenarios:
+  - name: %s
+    url: http://127.0.0.1/
+    throughput: 10
+    count: 1
+    %s: true
+`, field, field))
+			err := validateMixed([]Scenario{s})
+			if err == nil || !strings.Contains(err.Error(), field+" cannot be used with -mixed") {
+				t.Errorf("expected %s rejected with -mixed, got: %v", field, err)
+			}
+		})
+	}
+}
+
+func TestNamedTransportFlags(t *testing.T) {
+	defer func(conns int, header int64) {
+		maxConnsPerHost, maxResponseHeaderBytes = conns, header
+	}(maxConnsPerHost, maxResponseHeaderBytes)
+	maxConnsPerHost, maxResponseHeaderBytes = 7, 4096
+
+	data, err := LoadScenarioFile(strings.NewReader(`
+transports:
+  plain: {}
+  capped:
+    max_conns_per_host: 2
+scenarios:
+  - name: plain
+    url: http://127.0.0.1/
+    throughput: 1
+    transport: plain
+  - name: capped
+    url: http://127.0.0.1/
+    throughput: 1
+    transport: capped
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{7, 2} {
+		s := data.Scenarios[i]
+		tr := s.transport.transport
+		if tr.MaxConnsPerHost != expected {
+			t.Errorf("%s: max conns per host: expected: %d, got: %d", s.Name, expected, tr.MaxConnsPerHost)
+		}
+		if tr.MaxResponseHeaderBytes != 4096 {
+			t.Errorf("%s: max response header bytes: expected: 4096, got: %d", s.Name, tr.MaxResponseHeaderBytes)
+		}
+	}
+}
+
+func TestReachedTargets(t *testing.T) {
+	s := loadScenario(t, `
+scenarios:
+  - name: counted
+    url: http://127.0.0.1/
+    throughput: 10
+    count: 10
+`)
+	scenarios := []Scenario{s}
+	cases := []struct {
+		name    string
+		report  ScenarioReport
+		reached bool
+	}{
+		{"completed", ScenarioReport{SuccessCount: 8, RequestFailCount: 2}, true},
+		// drained run stops before count
+		{"stopped early", ScenarioReport{SuccessCount: 4}, false},
+		{"aborted", ScenarioReport{SuccessCount: 10, AbortReason: "p95"}, false},
+	}
+	for _, c := range cases {
+		reports := map[string]ScenarioReport{s.Name: c.report}
+		if got := reachedTargets(scenarios, reports, false); got != c.reached {
+			t.Errorf("%s: expected: %v, got: %v", c.name, c.reached, got)
+		}
+	}
+	if reachedTargets(scenarios, map[string]ScenarioReport{}, false) {
+		t.Error("not started scenario reached target")
+	}
+}
+
+func TestJSONLRequestID(t *testing.T) {
+	sent := make(chan string, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- r.Header.Get(defaultCorrelationHeader)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "splay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/results.jsonl"
+	w, err := newJSONLWriter(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultStream = w
+	defer func() { resultStream = nil }()
+
+	s := loadScenario(t, fmt.Sprintf(`
+scenarios:
+  - name: correlated
+    url: %s
+    throughput: 10
+    count: 3
+    correlation_id: true
+`, srv.URL))
+	runScenario(t, s)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(sent)
+	ids := make(map[string]bool)
+	for id := range sent {
+		ids[id] = true
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines: expected: 3, got: %d", len(lines))
+	}
+	for _, line := range lines {
+		var e requestEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.RequestID == "" || !ids[e.RequestID] {
+			t.Errorf("request_id is not sent one: %s", line)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// version is set by -ldflags "-X main.version=..."
+var version = "dev"
+
+// Manifest is run settings to reproduce the run
+type Manifest struct {
+	Version string
+	// Flags is flags changed from default
+	Flags     map[string]string
+	Scenarios []Scenario
+	// Shard is -shard slice run by this instance, empty when not sharded
+	Shard      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// NewManifest creates manifest from parsed flags and loaded scenarios.
+// Only flags changed from default are kept, and secrets are redacted the
+// same as -dump-config, since manifest is printed on every run
+func NewManifest(scenarios []Scenario) Manifest {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if v := f.Value.String(); v != f.DefValue {
+			flags[f.Name] = redactURL(v)
+		}
+	})
+	redactedScenarios := make([]Scenario, len(scenarios))
+	for i, s := range scenarios {
+		redactedScenarios[i] = redactScenario(s)
+	}
+	return Manifest{
+		Version:   version,
+		Flags:     flags,
+		Scenarios: redactedScenarios,
+	}
+}
+
+func printManifest(m Manifest) {
+	resultLog.Println("--------------------Manifest--------------------")
+	resultLog.Printf("version: %s", m.Version)
+	resultLog.Printf("started: %s", m.StartedAt.Format(time.RFC3339))
+	resultLog.Printf("finished: %s", m.FinishedAt.Format(time.RFC3339))
+	resultLog.Printf("elapsed: %s", m.FinishedAt.Sub(m.StartedAt).Round(time.Millisecond))
+	if m.Shard != "" {
+		resultLog.Printf("shard: %s", m.Shard)
+	}
+
+	// flag.VisitAll visits in lexicographical order, use it again for stable output
+	flag.VisitAll(func(f *flag.Flag) {
+		if v, ok := m.Flags[f.Name]; ok {
+			resultLog.Printf("flag: -%s=%s", f.Name, v)
+		}
+	})
+
+	b, err := yaml.Marshal(map[string][]Scenario{"scenarios": m.Scenarios})
+	if err != nil {
+		resultLog.Printf("Error: %s", err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		resultLog.Printf("scenario| %s", line)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runMonitor runs each scenario once per interval until ctx is cancelled
+// and prints status line per round. Closing drain stops it after the
+// current round. Nothing is kept across rounds.
+func runMonitor(ctx context.Context, drain <-chan struct{}, scenarios []Scenario, interval time.Duration) {
+	one := 1
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reports := make([]ScenarioReport, len(scenarios))
+		wg := sync.WaitGroup{}
+		for i, s := range scenarios {
+			s.Count = &one
+			// one request has no period to ramp down in
+			s.Period = nil
+			s.RampDown = nil
+			wg.Add(1)
+			go func(i int, s Scenario) {
+				defer wg.Done()
+				reports[i] = ScenarioRun(ctx, nil, s)
+			}(i, s)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+
+		status := make([]string, len(scenarios))
+		for i, s := range scenarios {
+			r := reports[i]
+			switch {
+			case r.RequestFailCount > 0:
+				status[i] = s.Name + "=request_fail"
+			case r.ValidationFailCount > 0:
+				status[i] = s.Name + "=validation_fail"
+			default:
+				status[i] = fmt.Sprintf("%s=ok(%.1fms)", s.Name, ms(r.Latency.Max))
+			}
+		}
+		resultLog.Printf("monitor|\t%s", strings.Join(status, " "))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-drain:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// events is set by -nats-url
+var events *natsPublisher
+
+// NATS publisher settings
+const (
+	natsQueueSize      = 10000
+	natsBatchSize      = 100
+	natsFlushInterval  = 100 * time.Millisecond
+	natsReconnectDelay = 5 * time.Second
+	natsDialTimeout    = 5 * time.Second
+)
+
+// requestEvent is result of single request published to NATS and
+// written by -o jsonl
+type requestEvent struct {
+	Time      time.Time `json:"ts"`
+	Scenario  string    `json:"scenario"`
+	URL       string    `json:"url"`
+	Result    string    `json:"result"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	TTFBMs    float64   `json:"ttfb_ms"`
+	Error     string    `json:"error,omitempty"`
+	Shard     string    `json:"shard,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+func newRequestEvent(r Result, end time.Time, shard string) requestEvent {
+	return requestEvent{
+		Time:      end.UTC(),
+		Scenario:  r.Name,
+		URL:       r.URL,
+		Result:    resultStateName(r.State),
+		Status:    r.StatusCode,
+		LatencyMs: ms(r.Latency),
+		TTFBMs:    ms(r.TTFB),
+		Error:     r.Error,
+		Shard:     shard,
+		RequestID: r.RequestID,
+	}
+}
+
+// natsPublisher publishes request events to NATS subject with core NATS
+// text protocol. Events are queued and written in batches, and dropped
+// while broker is unreachable so that load is never blocked by it
+type natsPublisher struct {
+	addr    string
+	subject string
+	shard   string
+	queue   chan requestEvent
+
+	mu      sync.Mutex
+	dropped int
+
+	conn      net.Conn
+	w         *bufio.Writer
+	lastDial  time.Time
+	connected bool
+	// pong is signalled by readLoop, PONG is written by run so that it
+	// never interleaves with PUB
+	pong chan struct{}
+	done chan struct{}
+}
+
+// newNATSPublisher starts publisher to rawURL (nats://host:port). Broker
+// being unreachable is not error, it is retried in background
+func newNATSPublisher(rawURL, subject, shard string) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "tls" {
+		return nil, xerrors.Errorf("nats over TLS is not supported: %q", redactURL(rawURL))
+	}
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, xerrors.Errorf("nats url must be nats://host:port: %q", redactURL(rawURL))
+	}
+	if u.User != nil {
+		return nil, xerrors.Errorf("nats authentication is not supported, remove credentials from url: %q", redactURL(rawURL))
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, xerrors.Errorf("invalid nats subject: %q", subject)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	p := &natsPublisher{
+		addr:    addr,
+		subject: subject,
+		shard:   shard,
+		queue:   make(chan requestEvent, natsQueueSize),
+		pong:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// publish queues result without blocking, event is dropped when queue is full
+func (p *natsPublisher) publish(r Result, end time.Time) {
+	select {
+	case p.queue <- newRequestEvent(r, end, p.shard):
+	default:
+		p.drop(1)
+	}
+}
+
+func (p *natsPublisher) drop(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dropped += n
+}
+
+func (p *natsPublisher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(natsFlushInterval)
+	defer ticker.Stop()
+	batch := make([]requestEvent, 0, natsBatchSize)
+	for {
+		select {
+		case e, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				p.close()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) < natsBatchSize {
+				continue
+			}
+		case <-p.pong:
+			if p.connected {
+				_, _ = p.w.WriteString("PONG\r\n")
+			}
+		case <-ticker.C:
+			if len(batch) == 0 && !p.connected {
+				continue
+			}
+		}
+		p.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes batch as PUB messages, batch is dropped when not connected
+func (p *natsPublisher) flush(batch []requestEvent) {
+	if len(batch) == 0 {
+		if p.connected && p.w.Buffered() > 0 {
+			if err := p.w.Flush(); err != nil {
+				p.close()
+			}
+		}
+		return
+	}
+	if !p.connected && !p.connect() {
+		p.drop(len(batch))
+		return
+	}
+	for _, e := range batch {
+		b, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		_, _ = fmt.Fprintf(p.w, "PUB %s %d\r\n", p.subject, len(b))
+		_, _ = p.w.Write(b)
+		_, _ = p.w.WriteString("\r\n")
+	}
+	if err := p.w.Flush(); err != nil {
+		resultLog.Printf("Error: nats: %s, events are dropped until reconnected", err)
+		p.drop(len(batch))
+		p.close()
+	}
+}
+
+// connect dials broker, at most once per natsReconnectDelay
+func (p *natsPublisher) connect() bool {
+	if time.Since(p.lastDial) < natsReconnectDelay {
+		return false
+	}
+	p.lastDial = time.Now()
+	conn, err := net.DialTimeout("tcp", p.addr, natsDialTimeout)
+	if err != nil {
+		resultLog.Printf("Error: nats: %s, events are dropped until reconnected", err)
+		return false
+	}
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(natsDialTimeout))
+	info, err := r.ReadString('\n')
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		resultLog.Printf("Error: nats: unexpected greeting from %s, events are dropped until reconnected", p.addr)
+		_ = conn.Close()
+		return false
+	}
+	var server natsServerInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(info, "INFO ")), &server); err == nil {
+		var required string
+		switch {
+		case server.TLSRequired:
+			required = "TLS"
+		case server.AuthRequired:
+			required = "authentication"
+		}
+		if required != "" {
+			resultLog.Printf("Error: nats: %s requires %s, which is not supported, events are dropped", p.addr, required)
+			_ = conn.Close()
+			return false
+		}
+	}
+	p.conn = conn
+	p.w = bufio.NewWriter(conn)
+	_, _ = p.w.WriteString(`CONNECT {"verbose":false,"pedantic":false,"name":"splay"}` + "\r\n")
+	p.connected = true
+	go p.readLoop(r)
+	return true
+}
+
+// natsServerInfo is INFO of broker, only what splay cannot do
+type natsServerInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	AuthRequired bool `json:"auth_required"`
+}
+
+// readLoop watches server PING, which must be answered to keep
+// connection alive
+func (p *natsPublisher) readLoop(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			select {
+			case p.pong <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			resultLog.Printf("Error: nats: %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+func (p *natsPublisher) close() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn, p.w, p.connected = nil, nil, false
+}
+
+// Close flushes queued events and closes connection. It returns count of
+// dropped events
+func (p *natsPublisher) Close() int {
+	close(p.queue)
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
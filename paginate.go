@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+)
+
+// defaultMaxPages is page limit of paginate when max_pages is not set
+const defaultMaxPages = 10
+
+// Paginate follows next page links of response as one scenario iteration
+type Paginate struct {
+	// Next is JSON path of next page URL, pagination ends when it is
+	// missing, null or empty
+	Next     string `yaml:"next,omitempty"`
+	MaxPages int    `yaml:"max_pages,omitempty"`
+	// Items is JSON path of items array of each page. Items of all pages
+	// of iteration are summed and checked with MinItems and MaxItems
+	Items    string `yaml:"items,omitempty"`
+	MinItems *int   `yaml:"min_items,omitempty"`
+	MaxItems *int   `yaml:"max_items,omitempty"`
+}
+
+// validate checks JSON paths and item count bounds
+func (p Paginate) validate() error {
+	if _, err := parseJSONPath(p.Next); err != nil {
+		return err
+	}
+	if p.Items == "" {
+		if p.MinItems != nil || p.MaxItems != nil {
+			return xerrors.New("min_items and max_items require items")
+		}
+		return nil
+	}
+	if _, err := parseJSONPath(p.Items); err != nil {
+		return xerrors.Errorf("items: %w", err)
+	}
+	if p.MinItems != nil && p.MaxItems != nil && *p.MinItems > *p.MaxItems {
+		return xerrors.Errorf("min_items is greater than max_items: %d > %d", *p.MinItems, *p.MaxItems)
+	}
+	return nil
+}
+
+func (p Paginate) maxPages() int {
+	if p.MaxPages > 0 {
+		return p.MaxPages
+	}
+	return defaultMaxPages
+}
+
+// nextPage returns next page URL of response, resolved against current URL
+func (p Paginate) nextPage(res *response) (string, bool, error) {
+	path, err := parseJSONPath(p.Next)
+	if err != nil {
+		return "", false, err
+	}
+	var body interface{}
+	if err := json.Unmarshal(res.body, &body); err != nil {
+		return "", false, xerrors.Errorf("paginate: %w", err)
+	}
+	v, ok := path.lookup(body)
+	if !ok || v == nil {
+		return "", false, nil
+	}
+	next, ok := v.(string)
+	if !ok {
+		return "", false, xerrors.Errorf("paginate: next is not string: %v", v)
+	}
+	if next == "" {
+		return "", false, nil
+	}
+	u, err := res.Request.URL.Parse(next)
+	if err != nil {
+		return "", false, xerrors.Errorf("paginate: %w", err)
+	}
+	return u.String(), true, nil
+}
+
+// pageItems returns length of items array of response
+func (p Paginate) pageItems(res *response) (int, error) {
+	path, err := parseJSONPath(p.Items)
+	if err != nil {
+		return 0, err
+	}
+	var body interface{}
+	if err := json.Unmarshal(res.body, &body); err != nil {
+		return 0, xerrors.Errorf("paginate: %w", err)
+	}
+	v, ok := path.lookup(body)
+	if !ok {
+		return 0, xerrors.Errorf("paginate: items %s not found", p.Items)
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return 0, xerrors.Errorf("paginate: items %s is not array: %v", p.Items, v)
+	}
+	return len(items), nil
+}
+
+// checkItems checks item count summed over pages of iteration
+func (p Paginate) checkItems(n int) error {
+	if p.MinItems != nil && n < *p.MinItems {
+		return xerrors.Errorf("paginate: items of all pages are too few: expected: >= %d, got: %d", *p.MinItems, n)
+	}
+	if p.MaxItems != nil && n > *p.MaxItems {
+		return xerrors.Errorf("paginate: items of all pages are too many: expected: <= %d, got: %d", *p.MaxItems, n)
+	}
+	return nil
+}
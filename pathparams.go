@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// PathParam is sequence of values substituted into {name} of URL. It is
+// either range from..to (inclusive) or list of values
+type PathParam struct {
+	From   *int     `yaml:"from,omitempty"`
+	To     *int     `yaml:"to,omitempty"`
+	Values []string `yaml:"values,omitempty"`
+}
+
+func (p PathParam) validate() error {
+	isRange := p.From != nil || p.To != nil
+	switch {
+	case isRange && len(p.Values) > 0:
+		return xerrors.New("from/to and values cannot be used together")
+	case isRange:
+		if p.From == nil || p.To == nil {
+			return xerrors.New("range requires both from and to")
+		}
+		if *p.From > *p.To {
+			return xerrors.Errorf("range is empty: from %d > to %d", *p.From, *p.To)
+		}
+	case len(p.Values) == 0:
+		return xerrors.New("sequence is empty, set from/to or values")
+	}
+	return nil
+}
+
+// value returns seq-th value of sequence, cycling from start after end
+func (p PathParam) value(seq int) string {
+	if len(p.Values) > 0 {
+		return p.Values[seq%len(p.Values)]
+	}
+	size := *p.To - *p.From + 1
+	return strconv.Itoa(*p.From + seq%size)
+}
+
+// validatePathParams checks sequences and that each param is used in URL
+func validatePathParams(s Scenario) error {
+	for _, name := range pathParamNames(s.PathParams) {
+		if err := s.PathParams[name].validate(); err != nil {
+			return xerrors.Errorf("path_params %s: %w", name, err)
+		}
+		placeholder := "{" + name + "}"
+		used := strings.Contains(s.URL, placeholder)
+		for _, u := range s.URLs {
+			used = used || strings.Contains(u.URL, placeholder)
+		}
+		if !used {
+			return xerrors.Errorf("path_params %s: %s is not in url", name, placeholder)
+		}
+	}
+	return nil
+}
+
+// expandPathParams substitutes seq-th value of each path param into rawURL
+func expandPathParams(rawURL string, params map[string]PathParam, seq int) string {
+	for _, name := range pathParamNames(params) {
+		rawURL = strings.Replace(rawURL, "{"+name+"}", url.PathEscape(params[name].value(seq)), -1)
+	}
+	return rawURL
+}
+
+// pathParamNames returns names of params in stable order
+func pathParamNames(params map[string]PathParam) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
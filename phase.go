@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+)
+
+// Scenario phases
+const (
+	phaseMain     = "main"
+	phaseSetup    = "setup"
+	phaseTeardown = "teardown"
+)
+
+// isHook reports whether scenario is setup or teardown, sent once
+// outside of load
+func (s Scenario) isHook() bool {
+	return s.Phase == phaseSetup || s.Phase == phaseTeardown
+}
+
+// validatePhase checks phase, hooks cannot have load settings
+func validatePhase(s Scenario) error {
+	switch s.Phase {
+	case "", phaseMain:
+		return nil
+	case phaseSetup, phaseTeardown:
+	default:
+		return xerrors.Errorf("unknown phase: %s", s.Phase)
+	}
+	if s.Period != nil || s.Count != nil || s.Throughput != nil || s.RampDown != nil ||
+		s.RandomOffset || s.LatencyAbort != nil || s.Assert != nil {
+		return xerrors.Errorf("%s is sent once, period, count, throughput, ramp_down, random_offset, latency_abort and assert cannot be set", s.Phase)
+	}
+	return nil
+}
+
+// splitPhases splits scenarios by phase keeping file order
+func splitPhases(scenarios []Scenario) (setup, main, teardown []Scenario) {
+	for _, s := range scenarios {
+		switch s.Phase {
+		case phaseSetup:
+			setup = append(setup, s)
+		case phaseTeardown:
+			teardown = append(teardown, s)
+		default:
+			main = append(main, s)
+		}
+	}
+	return setup, main, teardown
+}
+
+// runHooks sends each hook once in order. With stopOnFail, hooks after
+// failed one are not sent. ok is false when any hook failed
+func runHooks(ctx context.Context, hooks []Scenario, stopOnFail bool) (results []Result, ok bool) {
+	ok = true
+	for _, s := range hooks {
+		result := runRequest(ctx, nextRequest(s, scenarioRand(s.Name), 0), etagCache{})
+		results = append(results, result)
+		if result.State != ResultOK {
+			ok = false
+			if stopOnFail {
+				break
+			}
+		}
+	}
+	return results, ok
+}
+
+// printHooks prints result of each hook of phase, hooks without result
+// were skipped
+func printHooks(phase string, hooks []Scenario, results []Result) {
+	for _, r := range results {
+		switch r.State {
+		case ResultOK:
+			resultLog.Printf("%s|[%s]\tsuccess, status: %d, latency: %v", phase, r.Name, r.StatusCode, r.Latency)
+		case ResultValidationFail:
+			resultLog.Printf("%s|[%s]\tvalidation fail: %s", phase, r.Name, r.Error)
+		default:
+			resultLog.Printf("%s|[%s]\trequest fail: %s", phase, r.Name, r.Error)
+		}
+	}
+	for _, s := range hooks[len(results):] {
+		resultLog.Printf("%s|[%s]\tskipped", phase, s.Name)
+	}
+}
+
+// withHooks returns scenarios of all phases in the order they are sent
+func withHooks(setup, main, teardown []Scenario) []Scenario {
+	return append(append(append([]Scenario(nil), setup...), main...), teardown...)
+}
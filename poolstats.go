@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// pool is set by -verbose
+var pool *poolStats
+
+// poolStats is connection pool stats per dialed host of all transports,
+// counted by wrapping DialContext
+type poolStats struct {
+	mu    sync.Mutex
+	hosts map[string]*hostPoolStats
+}
+
+// hostPoolStats is connection counts of one host, updated atomically
+type hostPoolStats struct {
+	dials      int64
+	dialErrors int64
+	open       int64
+	peak       int64
+	closed     int64
+}
+
+func newPoolStats() *poolStats {
+	return &poolStats{hosts: make(map[string]*hostPoolStats)}
+}
+
+func (p *poolStats) host(addr string) *hostPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.hosts[addr]
+	if !ok {
+		h = &hostPoolStats{}
+		p.hosts[addr] = h
+	}
+	return h
+}
+
+// instrument wraps DialContext of t to count connections
+func (p *poolStats) instrument(t *http.Transport) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		h := p.host(addr)
+		atomic.AddInt64(&h.dials, 1)
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			atomic.AddInt64(&h.dialErrors, 1)
+			return nil, err
+		}
+		open := atomic.AddInt64(&h.open, 1)
+		for {
+			peak := atomic.LoadInt64(&h.peak)
+			if open <= peak || atomic.CompareAndSwapInt64(&h.peak, peak, open) {
+				break
+			}
+		}
+		return &countedConn{Conn: conn, h: h}, nil
+	}
+}
+
+// countedConn decrements open count of host once when closed
+type countedConn struct {
+	net.Conn
+	h    *hostPoolStats
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.h.open, -1)
+		atomic.AddInt64(&c.h.closed, 1)
+	})
+	return c.Conn.Close()
+}
+
+// print prints stats of each host in order
+func (p *poolStats) print() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addrs := make([]string, 0, len(p.hosts))
+	for addr := range p.hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		h := p.hosts[addr]
+		resultLog.Printf("pool|[%s]\tdials: %d, dial errors: %d, peak open: %d, closed: %d, open: %d",
+			addr, atomic.LoadInt64(&h.dials), atomic.LoadInt64(&h.dialErrors), atomic.LoadInt64(&h.peak),
+			atomic.LoadInt64(&h.closed), atomic.LoadInt64(&h.open))
+	}
+}
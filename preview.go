@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// previewRequest is request rendered by -preview
+type previewRequest struct {
+	Scenario string              `json:"scenario"`
+	Seq      int                 `json:"seq"`
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Header   map[string][]string `json:"header,omitempty"`
+	Body     string              `json:"body,omitempty"`
+	// BodyBase64 is body which is not text, such as grpc-web frame
+	BodyBase64 string `json:"body_base64,omitempty"`
+}
+
+// previewScenarios writes first n requests of each scenario as they are
+// generated in run, after URL selection and path params, without sending
+// them. JSON is one request per line
+func previewScenarios(w io.Writer, scenarios []Scenario, n int, asJSON bool) error {
+	enc := json.NewEncoder(w)
+	for _, s := range scenarios {
+		r := scenarioRand(s.Name)
+		if s.RandomOffset && !s.rps().unlimited() {
+			// keep the random stream the same as run
+			r.Float64()
+		}
+		for i := 0; i < n; i++ {
+			p, err := renderRequest(nextRequest(s, r, i))
+			if err != nil {
+				return err
+			}
+			p.Seq = i + 1
+			if asJSON {
+				if err := enc.Encode(p); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := p.write(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderRequest builds request of scenario as worker sends it
+func renderRequest(s Scenario) (previewRequest, error) {
+	requestID := ""
+	if s.hasCorrelationID() {
+		id, err := newUUID()
+		if err != nil {
+			return previewRequest{}, err
+		}
+		requestID = id
+	}
+	req, err := prepareRequest(s, s.URL, requestID)
+	if err != nil {
+		return previewRequest{}, xerrors.Errorf("scenario %s: %w", s.Name, err)
+	}
+	p := previewRequest{Scenario: s.Name, Method: req.Method, URL: req.URL.String(), Header: req.Header}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return previewRequest{}, err
+		}
+		_ = req.Body.Close()
+		if isText(b) {
+			p.Body = string(b)
+		} else {
+			p.BodyBase64 = base64.StdEncoding.EncodeToString(b)
+		}
+	}
+	return p, nil
+}
+
+// write writes request in HTTP/1.1 like text
+func (p previewRequest) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "[%s] #%d\n%s %s\n", p.Scenario, p.Seq, p.Method, p.URL); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(p.Header))
+	for k := range p.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range p.Header[k] {
+			if _, err := fmt.Fprintf(w, "%s: %s\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	switch {
+	case p.Body != "":
+		_, err := fmt.Fprintf(w, "\n%s\n\n", p.Body)
+		return err
+	case p.BodyBase64 != "":
+		_, err := fmt.Fprintf(w, "\n(base64) %s\n\n", p.BodyBase64)
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// isText reports whether b is UTF-8 without control characters other
+// than whitespace
+func isText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+
+	"golang.org/x/xerrors"
+)
+
+// problemContentType is media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// problem is RFC 7807 problem details object
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// parseProblem decodes problem details of response. It fails when
+// response is not application/problem+json
+func parseProblem(res *response) (*problem, error) {
+	ct := res.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil || mediaType != problemContentType {
+		return nil, xerrors.Errorf("response is not %s: content type: %q", problemContentType, ct)
+	}
+	p := &problem{}
+	if err := json.Unmarshal(res.body, p); err != nil {
+		return nil, xerrors.Errorf("decode problem details: %w", err)
+	}
+	// type defaults to about:blank by RFC 7807
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	return p, nil
+}
+
+// hasProblem reports whether validate checks problem details fields
+func (v Validate) hasProblem() bool {
+	return v.ProblemType != nil || v.ProblemTitle != nil || v.ProblemStatus != nil
+}
+
+// checkProblem validates problem details fields of response
+func (v Validate) checkProblem(res *response) error {
+	p, err := parseProblem(res)
+	if err != nil {
+		return err
+	}
+	if v.ProblemType != nil && p.Type != *v.ProblemType {
+		return xerrors.Errorf("problem type is invalid: expected: %v, got: %v", *v.ProblemType, p.Type)
+	}
+	if v.ProblemTitle != nil && p.Title != *v.ProblemTitle {
+		return xerrors.Errorf("problem title is invalid: expected: %v, got: %v", *v.ProblemTitle, p.Title)
+	}
+	if v.ProblemStatus != nil && p.Status != *v.ProblemStatus {
+		return xerrors.Errorf("problem status is invalid: expected: %v, got: %v", *v.ProblemStatus, p.Status)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+var (
+	// seed is -seed value
+	seed int64
+	// seedPerScenario gives each scenario independent random stream
+	seedPerScenario bool
+)
+
+// rng is random source shared by scenarios, seeded by -seed
+var rng = rand.New(newLockedSource(1))
+
+// scenarioRand returns random source used by scenario. With
+// -seed-per-scenario, it is independent stream seeded by
+// seed XOR FNV-1a(name), so draws of one scenario never shift another's.
+// Otherwise it is shared rng.
+func scenarioRand(name string) *rand.Rand {
+	if !seedPerScenario {
+		return rng
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+// lockedSource is rand.Source safe for concurrent use
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func newLockedSource(seed int64) *lockedSource {
+	return &lockedSource{src: rand.NewSource(seed)}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// WeightedURL is request URL with selection weight
+type WeightedURL struct {
+	URL    string  `yaml:"url,omitempty"`
+	Weight float64 `yaml:"weight,omitempty"`
+}
+
+// pickURL selects URL randomly in proportion to weights
+func pickURL(r *rand.Rand, urls []WeightedURL) string {
+	weights := make([]float64, len(urls))
+	for i, u := range urls {
+		weights[i] = u.Weight
+	}
+	return urls[pickWeighted(r, weights)].URL
+}
+
+// pickWeighted selects index randomly in proportion to weights
+func pickWeighted(r *rand.Rand, weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	x := r.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(weights) - 1
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// reuseRequests is set by -reuse-requests
+var reuseRequests bool
+
+// requestTemplates caches requestTemplate per requestKey
+var requestTemplates sync.Map
+
+// requestKey is scenario name and URL of requestTemplate
+type requestKey struct {
+	name, url string
+}
+
+// requestTemplate is request parsed once and cloned per send. body is
+// kept as bytes so that each clone reads its own fresh reader
+type requestTemplate struct {
+	req  *http.Request
+	body []byte
+}
+
+// newRequest creates request of scenario to url. With -reuse-requests,
+// request to scenario URL is cloned from cached template instead of
+// parsed again. Paginated pages and path_params URLs are always built
+// fresh
+func newRequest(s Scenario, url string) (*http.Request, error) {
+	// path params make URL per request, caching them would grow unbounded
+	if !reuseRequests || url != s.URL || len(s.PathParams) > 0 {
+		return buildRequest(s, url)
+	}
+	key := requestKey{name: s.Name, url: url}
+	if t, ok := requestTemplates.Load(key); ok {
+		return t.(*requestTemplate).clone(), nil
+	}
+	t, err := newRequestTemplate(s, url)
+	if err != nil {
+		return nil, err
+	}
+	requestTemplates.Store(key, t)
+	return t.clone(), nil
+}
+
+// buildRequest parses new request of scenario to url, with static
+// headers set
+func buildRequest(s Scenario, url string) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if s.Protocol == protocolGRPCWeb {
+		req, err = newGRPCWebRequest(s)
+	} else {
+		req, err = http.NewRequest("GET", url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.setStaticHeaders(req)
+	return req, nil
+}
+
+func newRequestTemplate(s Scenario, url string) (*requestTemplate, error) {
+	req, err := buildRequest(s, url)
+	if err != nil {
+		return nil, err
+	}
+	t := &requestTemplate{req: req}
+	if s.Protocol == protocolGRPCWeb {
+		if t.body, err = grpcWebFrame(s); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// clone returns shallow copy of template with own header and body, so
+// that per request headers do not leak into template
+func (t *requestTemplate) clone() *http.Request {
+	req := new(http.Request)
+	*req = *t.req
+	req.Header = make(http.Header, len(t.req.Header))
+	n := 0
+	for _, v := range t.req.Header {
+		n += len(v)
+	}
+	// values of all headers share one allocation, capped so that append
+	// to one header does not overwrite next one
+	values := make([]string, n)
+	for k, v := range t.req.Header {
+		copy(values, v)
+		req.Header[k] = values[:len(v):len(v)]
+		values = values[len(v):]
+	}
+	if t.body != nil {
+		body := t.body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return req
+}
+
+// copyBufPool pools buffers used to discard unread response body
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
+// drainBody reads rest of body with pooled buffer so that connection can
+// be reused
+func drainBody(body io.Reader) error {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+	_, err := io.CopyBuffer(ioutil.Discard, body, *buf)
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// runSelftest runs built-in scenario with unlimited throughput against
+// in-process server which responds after latency, and prints calibration
+// summary: max RPS this machine sustains with current -c and how much
+// latency splay adds over server time
+func runSelftest(latency, duration time.Duration) error {
+	if duration < time.Second {
+		return xerrors.Errorf("-selftest-duration must be at least 1s: %v", duration)
+	}
+	// server time is summed in nanoseconds to subtract it from latency
+	var served, serverTime int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		w.WriteHeader(http.StatusOK)
+		atomic.AddInt64(&served, 1)
+		atomic.AddInt64(&serverTime, int64(time.Since(start)))
+	}))
+	defer srv.Close()
+
+	period := int(duration / time.Second)
+	throughput := Throughput(0)
+	s := Scenario{Name: "selftest", URL: srv.URL, Period: &period, Throughput: &throughput}
+	log.Printf("selftest: %d workers, server latency %v, %ds", httpWorkerNum, latency, period)
+	report := ScenarioRun(context.Background(), nil, s)
+
+	l := report.Latency
+	resultLog.Println("--------------------Selftest--------------------")
+	resultLog.Printf("selftest|\tworkers: %d, server latency: %v, period: %ds", httpWorkerNum, latency, period)
+	resultLog.Printf("selftest|\tsuccess: %d, validation fail: %d, request fail: %d",
+		report.SuccessCount, report.ValidationFailCount, report.RequestFailCount)
+	resultLog.Printf("selftest|\tmax rps: %.2f", report.AchievedRPS)
+	resultLog.Printf("selftest|\tlatency p50: %v, p95: %v, p99: %v, max: %v, mean: %v", l.P50, l.P95, l.P99, l.Max, l.Mean)
+	if n := atomic.LoadInt64(&served); n > 0 {
+		overhead := l.Mean - time.Duration(atomic.LoadInt64(&serverTime)/n)
+		resultLog.Printf("selftest|\toverhead: %v per request (mean latency minus server time)", overhead)
+	}
+	if latency > 0 {
+		// each worker can have one request in flight, so latency caps rps
+		bound := float64(httpWorkerNum) / latency.Seconds()
+		resultLog.Printf("selftest|\tworker bound: %.2f rps (%.1f%% reached)", bound, report.AchievedRPS/bound*100)
+	}
+	if report.RequestFailCount > 0 || report.ValidationFailCount > 0 {
+		return xerrors.Errorf("selftest: %d requests failed", report.RequestFailCount+report.ValidationFailCount)
+	}
+	return nil
+}
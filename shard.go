@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// shard is slice i of N of load run by this instance, index is 1-based
+type shard struct {
+	index int
+	total int
+}
+
+// parseShard parses -shard value "i/N"
+func parseShard(v string) (shard, error) {
+	sh := shard{}
+	var rest string
+	n, _ := fmt.Sscanf(v, "%d/%d%s", &sh.index, &sh.total, &rest)
+	if n != 2 || sh.total < 1 || sh.index < 1 || sh.index > sh.total {
+		return shard{}, xerrors.Errorf("invalid shard, must be i/N with 1 <= i <= N: %q", v)
+	}
+	return sh, nil
+}
+
+func (sh shard) String() string {
+	return fmt.Sprintf("%d/%d", sh.index, sh.total)
+}
+
+// apply returns scenario running only this shard's slice. Throughput is
+// divided by N, and requests are split so that shards sum up to the
+// configured count; first count%N shards run one extra request
+func (sh shard) apply(s Scenario) Scenario {
+	total := requestCount(s)
+	count := total / sh.total
+	if sh.index <= total%sh.total {
+		count++
+	}
+	throughput := s.rps() / Throughput(sh.total)
+	s.Throughput = &throughput
+	s.Count = &count
+	return s
+}
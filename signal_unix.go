@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignal reopens -log-file after rotation
+var reopenSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,8 @@
+package main
+
+import (
+	"os"
+)
+
+// reopenSignal is nil, Windows has no signal to reopen -log-file
+var reopenSignal os.Signal
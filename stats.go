@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LatencyStats is latency summary of responded requests
+type LatencyStats struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+	Max time.Duration
+	// Mean and StdDev are of all latencies, StdDev is population stddev
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+// CV returns coefficient of variation (stddev / mean), 0 without samples
+func (l LatencyStats) CV() float64 {
+	if l.Mean == 0 {
+		return 0
+	}
+	return float64(l.StdDev) / float64(l.Mean)
+}
+
+// NewLatencyStats calculates stats. latencies is sorted in place
+func NewLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var sum float64
+	for _, l := range latencies {
+		sum += float64(l)
+	}
+	mean := sum / float64(len(latencies))
+	var sq float64
+	for _, l := range latencies {
+		d := float64(l) - mean
+		sq += d * d
+	}
+	return LatencyStats{
+		P50:    percentile(latencies, 50),
+		P95:    percentile(latencies, 95),
+		P99:    percentile(latencies, 99),
+		Max:    latencies[len(latencies)-1],
+		Mean:   time.Duration(mean),
+		StdDev: time.Duration(math.Sqrt(sq / float64(len(latencies)))),
+	}
+}
+
+// percentile returns nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// sortedKeys returns keys of count map in order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatStatusCounts formats status counts like "200: 10, 500: 2"
+func formatStatusCounts(m map[int]int) string {
+	codes := make([]int, 0, len(m))
+	for code := range m {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%d: %d", code, m[code])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// count5xx returns count of 5xx responses
+func count5xx(m map[int]int) int {
+	var n int
+	for code, c := range m {
+		if code >= 500 && code < 600 {
+			n += c
+		}
+	}
+	return n
+}
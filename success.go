@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+)
+
+// SuccessRule is combined success definition of scenario: response is
+// success only when status matches AND body condition holds, otherwise
+// it is validation fail. It is for APIs returning errors with 200
+type SuccessRule struct {
+	// Status is status codes of success, any status when empty
+	Status []int `yaml:"status,omitempty"`
+	// BodyContains and BodyNotContains are substrings body must and must
+	// not contain
+	BodyContains    *string `yaml:"body_contains,omitempty"`
+	BodyNotContains *string `yaml:"body_not_contains,omitempty"`
+	// JSONAbsent is JSON path which must not exist in body, such as
+	// $.error. Body which is not JSON has no path
+	JSONAbsent *string `yaml:"json_absent,omitempty"`
+}
+
+// hasBodyCondition reports whether rule reads body
+func (r SuccessRule) hasBodyCondition() bool {
+	return r.BodyContains != nil || r.BodyNotContains != nil || r.JSONAbsent != nil
+}
+
+// validate checks rule settings
+func (r SuccessRule) validate() error {
+	if len(r.Status) == 0 && !r.hasBodyCondition() {
+		return xerrors.New("success needs status or a body condition")
+	}
+	if r.JSONAbsent != nil {
+		if _, err := parseJSONPath(*r.JSONAbsent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check reports why response is not success, nil when it is
+func (r SuccessRule) check(res *response) error {
+	if len(r.Status) > 0 {
+		ok := false
+		for _, code := range r.Status {
+			if res.StatusCode == code {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return xerrors.Errorf("success: status code is invalid: expected: %v, got: %v", r.Status, res.StatusCode)
+		}
+	}
+	if r.BodyContains != nil && !bytes.Contains(res.body, []byte(*r.BodyContains)) {
+		return xerrors.Errorf("success: body does not contain %q", *r.BodyContains)
+	}
+	if r.BodyNotContains != nil && bytes.Contains(res.body, []byte(*r.BodyNotContains)) {
+		return xerrors.Errorf("success: body contains %q", *r.BodyNotContains)
+	}
+	if r.JSONAbsent != nil {
+		path, err := parseJSONPath(*r.JSONAbsent)
+		if err != nil {
+			return err
+		}
+		var body interface{}
+		if json.Unmarshal(res.body, &body) == nil {
+			if v, ok := path.lookup(body); ok {
+				b, _ := json.Marshal(v)
+				return xerrors.Errorf("success: json path %s exists: %s", *r.JSONAbsent, b)
+			}
+		}
+	}
+	return nil
+}
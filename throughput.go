@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// unlimitedThroughput is throughput value sending as fast as workers allow
+const unlimitedThroughput = "unlimited"
+
+// Throughput is requests per second, 0 or "unlimited" means no rate limit
+type Throughput float64
+
+// UnmarshalYAML accepts number or "unlimited"
+func (t *Throughput) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil && s == unlimitedThroughput {
+		*t = 0
+		return nil
+	}
+	var f float64
+	if err := unmarshal(&f); err != nil {
+		return xerrors.Errorf("throughput must be number or %s", unlimitedThroughput)
+	}
+	if f < 0 {
+		return xerrors.Errorf("throughput must not be negative: %v", f)
+	}
+	*t = Throughput(f)
+	return nil
+}
+
+// MarshalYAML writes "unlimited" for no rate limit
+func (t Throughput) MarshalYAML() (interface{}, error) {
+	if t.unlimited() {
+		return unlimitedThroughput, nil
+	}
+	return float64(t), nil
+}
+
+func (t Throughput) unlimited() bool {
+	return t == 0
+}
+
+// limit returns rate of limiter
+func (t Throughput) limit() rate.Limit {
+	if t.unlimited() {
+		return rate.Inf
+	}
+	return rate.Limit(t)
+}
+
+func (t Throughput) String() string {
+	if t.unlimited() {
+		return unlimitedThroughput
+	}
+	return fmt.Sprintf("%.2f rps", float64(t))
+}
+
+// unboundedCount is request count of period scenario without rate limit,
+// the period bounds it
+const unboundedCount = math.MaxInt32
+
+// rps returns throughput of scenario, which is checked to be set on load
+func (s Scenario) rps() Throughput {
+	return *s.Throughput
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// timeseries is set by -timeseries-file
+var timeseries *timeseriesWriter
+
+// timeseriesRow is metrics of scenario in one second
+type timeseriesRow struct {
+	Time     time.Time `json:"ts"`
+	Scenario string    `json:"scenario"`
+	RPS      float64   `json:"rps"`
+	Errors   int       `json:"errors"`
+	P95Ms    float64   `json:"p95_ms"`
+}
+
+// timeseriesWriter aggregates live counters every second and writes a row
+// per scenario. Each tick is flushed, so rows survive a crash
+type timeseriesWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	csv  bool
+	prev map[string]CheckpointCounts
+	last time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startTimeseries creates file and starts 1Hz aggregator
+func startTimeseries(path string) (*timeseriesWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, xerrors.Errorf("create timeseries file: %w", err)
+	}
+	t := &timeseriesWriter{
+		f:    f,
+		w:    bufio.NewWriter(f),
+		csv:  strings.HasSuffix(path, ".csv"),
+		prev: make(map[string]CheckpointCounts),
+		last: time.Now(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	// counts carried over by -resume are not of this run
+	for name, c := range resumed {
+		t.prev[name] = c
+	}
+	if t.csv {
+		_, _ = t.w.WriteString("ts,scenario,rps,errors,p95_ms\n")
+	}
+	go t.run()
+	return t, nil
+}
+
+func (t *timeseriesWriter) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			if err := t.tick(now); err != nil {
+				resultLog.Printf("Error: %s", err)
+			}
+		}
+	}
+}
+
+// tick writes rows of the second ended at now. It is called only by run,
+// or by Close after run returned
+func (t *timeseriesWriter) tick(now time.Time) error {
+	elapsed := now.Sub(t.last).Seconds()
+	t.last = now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	builders := live.snapshot()
+	names := make([]string, 0, len(builders))
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b := builders[name]
+		counts, window := b.tick()
+		prev := t.prev[name]
+		t.prev[name] = counts
+		row := timeseriesRow{
+			Time:     now.UTC().Truncate(time.Second),
+			Scenario: name,
+			RPS:      float64(counts.total()-prev.total()) / elapsed,
+			Errors:   counts.ValidationFail + counts.RequestFail - prev.ValidationFail - prev.RequestFail,
+			P95Ms:    ms(NewLatencyStats(window).P95),
+		}
+		if err := t.write(row); err != nil {
+			return xerrors.Errorf("timeseries: %w", err)
+		}
+	}
+	return t.w.Flush()
+}
+
+func (t *timeseriesWriter) write(row timeseriesRow) error {
+	if t.csv {
+		_, err := fmt.Fprintf(t.w, "%s,%s,%.2f,%d,%.3f\n",
+			row.Time.Format(time.RFC3339), csvField(row.Scenario), row.RPS, row.Errors, row.P95Ms)
+		return err
+	}
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	_, err = t.w.Write(append(b, '\n'))
+	return err
+}
+
+// csvField quotes field with comma, quote or newline
+func csvField(s string) string {
+	if !strings.ContainsAny(s, ",\"\n") {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// Close stops aggregator, writes last partial second and closes file
+func (t *timeseriesWriter) Close() error {
+	close(t.stop)
+	<-t.done
+	if err := t.tick(time.Now()); err != nil {
+		_ = t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
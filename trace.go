@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// tracer records request timeline when -trace-file is set
+var tracer *traceWriter
+
+// traceEvent is Chrome trace event format complete event ("ph": "X")
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Phase string            `json:"ph"`
+	TS    int64             `json:"ts"`
+	Dur   int64             `json:"dur"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+// traceWriter streams trace events to file as
+// {"traceEvents":[...]} which chrome://tracing and Perfetto load
+type traceWriter struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	start  time.Time
+	sample float64
+	n      int
+}
+
+func newTraceWriter(path string, sample float64) (*traceWriter, error) {
+	if sample <= 0 || sample > 1 {
+		return nil, xerrors.Errorf("trace sample must be in (0, 1]: %v", sample)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, xerrors.Errorf("create trace file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	if _, err := w.WriteString(`{"traceEvents":[`); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &traceWriter{f: f, w: w, start: time.Now(), sample: sample}, nil
+}
+
+// resultStateName returns name of state used in trace and events
+func resultStateName(state ResultState) string {
+	switch state {
+	case ResultValidationFail:
+		return "validation_fail"
+	case ResultRequestFail:
+		return "request_fail"
+	default:
+		return "ok"
+	}
+}
+
+// record writes request span of worker, sampled by -trace-sample
+func (t *traceWriter) record(workerID int, r Result, start, end time.Time) {
+	// global math/rand, sampling must not shift draws of scenario rng
+	if t.sample < 1 && rand.Float64() >= t.sample {
+		return
+	}
+	e := traceEvent{
+		Name:  r.Name,
+		Phase: "X",
+		TS:    int64(start.Sub(t.start) / time.Microsecond),
+		Dur:   int64(end.Sub(start) / time.Microsecond),
+		PID:   1,
+		TID:   workerID,
+		Args:  map[string]string{"url": r.URL, "result": resultStateName(r.State)},
+	}
+	if r.RequestID != "" {
+		e.Args["request_id"] = r.RequestID
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n > 0 {
+		_ = t.w.WriteByte(',')
+	}
+	_, _ = t.w.Write(b)
+	t.n++
+}
+
+// Close finishes JSON and closes file
+func (t *traceWriter) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.w.WriteString("]}\n"); err != nil {
+		return err
+	}
+	if err := t.w.Flush(); err != nil {
+		return err
+	}
+	return t.f.Close()
+}
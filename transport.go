@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// maxConnsPerHost and maxResponseHeaderBytes are set by flags, for
+// default transport and as base of named transports
+var (
+	maxConnsPerHost        int
+	maxResponseHeaderBytes int64
+)
+
+// TransportConfig is named HTTP transport in top-level transports of
+// scenario file. Unset fields are the same as default transport
+type TransportConfig struct {
+	MaxConnsPerHost     *int           `yaml:"max_conns_per_host"`
+	MaxIdleConnsPerHost *int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     *time.Duration `yaml:"idle_conn_timeout"`
+	TLSHandshakeTimeout *time.Duration `yaml:"tls_handshake_timeout"`
+	DisableKeepAlives   bool           `yaml:"disable_keep_alives"`
+	DisableCompression  bool           `yaml:"disable_compression"`
+	InsecureSkipVerify  bool           `yaml:"insecure_skip_verify"`
+}
+
+// namedTransport is transport built from TransportConfig, shared by all
+// scenarios referencing the name
+type namedTransport struct {
+	name      string
+	config    TransportConfig
+	transport *http.Transport
+}
+
+// transportRegistry is transports defined so far in scenario file
+type transportRegistry map[string]*namedTransport
+
+// add builds transports of one document, names must be unique in file
+func (r transportRegistry) add(configs map[string]TransportConfig) error {
+	for name, c := range configs {
+		if _, ok := r[name]; ok {
+			return xerrors.Errorf("transport %s is defined twice", name)
+		}
+		r[name] = &namedTransport{name: name, config: c, transport: c.build()}
+	}
+	return nil
+}
+
+// resolve sets transport of scenario referenced by name
+func (r transportRegistry) resolve(s *Scenario) error {
+	if s.Transport == "" {
+		return nil
+	}
+	t, ok := r[s.Transport]
+	if !ok {
+		return xerrors.Errorf("unknown transport: %s", s.Transport)
+	}
+	s.transport = t
+	return nil
+}
+
+// build returns new transport. Unset fields follow flags and
+// http.DefaultTransport
+func (c TransportConfig) build() *http.Transport {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost:    3000,
+		MaxConnsPerHost:        maxConnsPerHost,
+		MaxResponseHeaderBytes: maxResponseHeaderBytes,
+		IdleConnTimeout:        90 * time.Second,
+		TLSHandshakeTimeout:    10 * time.Second,
+		ExpectContinueTimeout:  1 * time.Second,
+		DisableKeepAlives:      c.DisableKeepAlives,
+		DisableCompression:     c.DisableCompression,
+	}
+	if c.MaxConnsPerHost != nil {
+		t.MaxConnsPerHost = *c.MaxConnsPerHost
+	}
+	if c.MaxIdleConnsPerHost != nil {
+		t.MaxIdleConnsPerHost = *c.MaxIdleConnsPerHost
+	}
+	if c.IdleConnTimeout != nil {
+		t.IdleConnTimeout = *c.IdleConnTimeout
+	}
+	if c.TLSHandshakeTimeout != nil {
+		t.TLSHandshakeTimeout = *c.TLSHandshakeTimeout
+	}
+	if c.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return t
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// urlsFileScenario is name of implicit scenario of -urls-file
+const urlsFileScenario = "urls-file"
+
+// readURLsFile reads URLs one per line. Blank lines and lines starting
+// with # are skipped
+func readURLsFile(in io.Reader) ([]string, error) {
+	var urls []string
+	sc := bufio.NewScanner(in)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, xerrors.Errorf("urls file line %d: invalid url: %s", n, line)
+		}
+		urls = append(urls, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, xerrors.Errorf("urls file: %w", err)
+	}
+	if len(urls) == 0 {
+		return nil, xerrors.New("urls file has no url")
+	}
+	return urls, nil
+}
+
+// newURLsFileScenario creates implicit scenario sending GET to each URL
+// in order, repeat times over the list
+func newURLsFileScenario(urls []string, throughput Throughput, repeat int) Scenario {
+	count := len(urls) * repeat
+	return Scenario{
+		Name:       urlsFileScenario,
+		URL:        urls[0],
+		Count:      &count,
+		Throughput: &throughput,
+		urlList:    urls,
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// defaultCommandTimeout bounds runtime of validate command
+const defaultCommandTimeout = 5 * time.Second
+
+// Validate is scenario validation structure
+type Validate struct {
+	Name string `yaml:"name,omitempty"`
+	// Message is used as failure message instead of generated one
+	Message string `yaml:"message,omitempty"`
+
+	StatusCode *int `yaml:"status_code,omitempty"`
+	// FinalURL is URL after following redirects
+	FinalURL       *string `yaml:"final_url,omitempty"`
+	FinalURLPrefix *string `yaml:"final_url_prefix,omitempty"`
+	// GRPCStatus is grpc-status of grpc-web response
+	GRPCStatus *int `yaml:"grpc_status,omitempty"`
+
+	// ProblemType, ProblemTitle and ProblemStatus are compared with fields
+	// of application/problem+json (RFC 7807) body
+	ProblemType   *string `yaml:"problem_type,omitempty"`
+	ProblemTitle  *string `yaml:"problem_title,omitempty"`
+	ProblemStatus *int    `yaml:"problem_status,omitempty"`
+
+	// CompressionRatioMin and CompressionRatioMax bound gzip encoded size
+	// divided by decoded size of body, uncompressed response is skipped
+	CompressionRatioMin *float64 `yaml:"compression_ratio_min,omitempty"`
+	CompressionRatioMax *float64 `yaml:"compression_ratio_max,omitempty"`
+
+	// Charset is charset Content-Type must declare, utf-8 when only
+	// VerifyCharset is set. Response without charset is taken as utf-8
+	Charset *string `yaml:"charset,omitempty"`
+	// VerifyCharset checks body is valid in the charset
+	VerifyCharset bool `yaml:"verify_charset,omitempty"`
+
+	// Cookie is expected Set-Cookie of response
+	Cookie *CookieValidate `yaml:"cookie,omitempty"`
+
+	// BodyIn is acceptable bodies, body trimmed of surrounding whitespace
+	// must equal one of them
+	BodyIn []string `yaml:"body_in,omitempty"`
+
+	// JSONPath is value of JSON body which must exist. With JSONMin or
+	// JSONMax, it must be a number within them (inclusive)
+	JSONPath *string  `yaml:"json_path,omitempty"`
+	JSONMin  *float64 `yaml:"json_min,omitempty"`
+	JSONMax  *float64 `yaml:"json_max,omitempty"`
+
+	// Command is run by sh -c with response body on stdin, non-zero exit
+	// is validation fail
+	Command        string         `yaml:"command,omitempty"`
+	CommandTimeout *time.Duration `yaml:"command_timeout,omitempty"`
+}
+
+// response is received response used by validations
+type response struct {
+	*http.Response
+	// body is read only when scenario needs it
+	body []byte
+
+	grpcStatus int
+	grpcErr    error
+
+	// compressed is true when body was gzip encoded on wire, with sizes
+	// before and after decoding
+	compressed   bool
+	wireBytes    int
+	decodedBytes int
+	decodeErr    error
+
+	latency time.Duration
+	// ttfb is time to first response byte
+	ttfb time.Duration
+	// clockSkew is server Date minus local time
+	clockSkew    time.Duration
+	hasClockSkew bool
+}
+
+// needsBody reports whether validation reads response body
+func (v Validate) needsBody() bool {
+	return v.Command != "" || v.hasProblem() || v.VerifyCharset || v.JSONPath != nil || len(v.BodyIn) > 0
+}
+
+// check validates response
+func (v Validate) check(ctx context.Context, res *response) error {
+	if v.StatusCode != nil && res.StatusCode != *v.StatusCode {
+		return xerrors.Errorf("status code is invalid: expected: %v, got: %v", *v.StatusCode, res.StatusCode)
+	}
+	finalURL := res.Request.URL.String()
+	if v.FinalURL != nil && finalURL != *v.FinalURL {
+		return xerrors.Errorf("final url is invalid: expected: %v, got: %v", *v.FinalURL, finalURL)
+	}
+	if v.FinalURLPrefix != nil && !strings.HasPrefix(finalURL, *v.FinalURLPrefix) {
+		return xerrors.Errorf("final url is invalid: expected prefix: %v, got: %v", *v.FinalURLPrefix, finalURL)
+	}
+	if v.GRPCStatus != nil {
+		if res.grpcErr != nil {
+			return xerrors.Errorf("grpc status: %w", res.grpcErr)
+		}
+		if res.grpcStatus != *v.GRPCStatus {
+			return xerrors.Errorf("grpc status is invalid: expected: %v, got: %v", *v.GRPCStatus, res.grpcStatus)
+		}
+	}
+	if v.hasCompressionRatio() {
+		if err := v.checkCompressionRatio(res); err != nil {
+			return err
+		}
+	}
+	if v.hasCharset() {
+		if err := v.checkCharset(res); err != nil {
+			return err
+		}
+	}
+	if v.Cookie != nil {
+		if err := v.Cookie.check(res); err != nil {
+			return err
+		}
+	}
+	if len(v.BodyIn) > 0 {
+		if err := v.checkBodyIn(res.body); err != nil {
+			return err
+		}
+	}
+	if v.JSONPath != nil {
+		if err := v.checkJSONPath(res); err != nil {
+			return err
+		}
+	}
+	if v.hasProblem() {
+		if err := v.checkProblem(res); err != nil {
+			return err
+		}
+	}
+	if v.Command != "" {
+		if err := v.runCommand(ctx, res.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxReportedBody is length of body quoted in failure message at most
+const maxReportedBody = 200
+
+// checkBodyIn validates trimmed body is one of body_in
+func (v Validate) checkBodyIn(body []byte) error {
+	got := strings.TrimSpace(string(body))
+	for _, want := range v.BodyIn {
+		if got == want {
+			return nil
+		}
+	}
+	if len(got) > maxReportedBody {
+		got = got[:maxReportedBody] + "..."
+	}
+	return xerrors.Errorf("body is invalid: expected one of: %q, got: %q", v.BodyIn, got)
+}
+
+// runCommand runs validate command with body on stdin
+func (v Validate) runCommand(ctx context.Context, body []byte) error {
+	timeout := defaultCommandTimeout
+	if v.CommandTimeout != nil {
+		timeout = *v.CommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stderr := bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", v.Command)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return xerrors.Errorf("command failed: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return xerrors.Errorf("command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	case <-ctx.Done():
+		_ = killProcessGroup(cmd)
+		<-done
+		if ctx.Err() == context.DeadlineExceeded {
+			return xerrors.Errorf("command timed out after %v: %s", timeout, v.Command)
+		}
+		return xerrors.Errorf("command cancelled: %s", v.Command)
+	}
+}